@@ -0,0 +1,335 @@
+package apu
+
+const (
+	// SampleRate is the rate of the stereo samples pushed into Buffer
+	SampleRate = 44100
+
+	// GB CPU is 4194304Hz
+	cpuClock = 4194304
+
+	// the frame sequencer is clocked at 512Hz. 4194304 / 512 = 8192
+	frameSequencerPeriod = 8192
+
+	// about 0.2 sec of audio
+	bufferSize = 8192
+)
+
+type APU struct {
+	ch1 square // tone & sweep
+	ch2 square // tone
+	ch3 wave
+	ch4 noise
+
+	nr50    uint8 // 0xff24 channel control / ON-OFF / volume
+	nr51    uint8 // 0xff25 selection of sound output terminal
+	enabled bool  // 0xff26 bit 7
+
+	frameSequencerCounter uint16
+	frameSequencerStep    uint8
+
+	sampleCounter uint32
+
+	// Buffer holds the mixed stereo output until the frontend drains it
+	Buffer *Buffer
+}
+
+func New() *APU {
+	apu := &APU{}
+
+	apu.ch1.hasSweep = true
+	apu.ch4.lfsr = 0x7fff
+
+	// the boot ROM leaves the sound circuit on
+	apu.enabled = true
+
+	apu.Buffer = NewBuffer(bufferSize)
+
+	return apu
+}
+
+func (apu *APU) Read(addr uint16) uint8 {
+	// wave pattern RAM
+	if 0xff30 <= addr && addr <= 0xff3f {
+		return apu.ch3.ram[addr-0xff30]
+	}
+
+	// unused bits are read as 1
+	switch addr {
+	// channel 1
+	case 0xff10:
+		return apu.ch1.readSweep()
+	case 0xff11:
+		return apu.ch1.duty<<6 | 0x3f
+	case 0xff12:
+		return apu.ch1.envelope.read()
+	case 0xff14:
+		return apu.readFreqHi(apu.ch1.length.enabled)
+
+	// channel 2
+	case 0xff16:
+		return apu.ch2.duty<<6 | 0x3f
+	case 0xff17:
+		return apu.ch2.envelope.read()
+	case 0xff19:
+		return apu.readFreqHi(apu.ch2.length.enabled)
+
+	// channel 3
+	case 0xff1a:
+		if apu.ch3.dacEnabled {
+			return 0xff
+		}
+		return 0x7f
+	case 0xff1c:
+		return apu.ch3.volumeCode<<5 | 0x9f
+	case 0xff1e:
+		return apu.readFreqHi(apu.ch3.length.enabled)
+
+	// channel 4
+	case 0xff21:
+		return apu.ch4.envelope.read()
+	case 0xff22:
+		return apu.ch4.readPoly()
+	case 0xff23:
+		return apu.readFreqHi(apu.ch4.length.enabled)
+
+	// control
+	case 0xff24:
+		return apu.nr50
+	case 0xff25:
+		return apu.nr51
+	case 0xff26:
+		return apu.readStatus()
+	}
+
+	// write only registers and unused area
+	return 0xff
+}
+
+func (apu *APU) readFreqHi(lengthEnabled bool) uint8 {
+	if lengthEnabled {
+		return 0xff
+	}
+	return 0xbf
+}
+
+func (apu *APU) readStatus() uint8 {
+	var val uint8 = 0x70
+
+	if apu.enabled {
+		val |= 0x80
+	}
+	if apu.ch1.enabled {
+		val |= 0x1
+	}
+	if apu.ch2.enabled {
+		val |= 0x2
+	}
+	if apu.ch3.enabled {
+		val |= 0x4
+	}
+	if apu.ch4.enabled {
+		val |= 0x8
+	}
+
+	return val
+}
+
+func (apu *APU) Write(addr uint16, val uint8) {
+	// wave pattern RAM is accessible even while the APU is off
+	if 0xff30 <= addr && addr <= 0xff3f {
+		apu.ch3.ram[addr-0xff30] = val
+		return
+	}
+
+	if addr == 0xff26 {
+		apu.writeStatus(val)
+		return
+	}
+
+	// registers are read only while the APU is off
+	if !apu.enabled {
+		return
+	}
+
+	switch addr {
+	// channel 1
+	case 0xff10:
+		apu.ch1.writeSweep(val)
+	case 0xff11:
+		apu.ch1.writeLength(val)
+	case 0xff12:
+		apu.ch1.envelope.write(val)
+		if !apu.ch1.envelope.isDACEnabled() {
+			apu.ch1.enabled = false
+		}
+	case 0xff13:
+		apu.ch1.freq = apu.ch1.freq&0x700 | uint16(val)
+	case 0xff14:
+		apu.ch1.writeFreqHi(val)
+
+	// channel 2
+	case 0xff16:
+		apu.ch2.writeLength(val)
+	case 0xff17:
+		apu.ch2.envelope.write(val)
+		if !apu.ch2.envelope.isDACEnabled() {
+			apu.ch2.enabled = false
+		}
+	case 0xff18:
+		apu.ch2.freq = apu.ch2.freq&0x700 | uint16(val)
+	case 0xff19:
+		apu.ch2.writeFreqHi(val)
+
+	// channel 3
+	case 0xff1a:
+		apu.ch3.dacEnabled = val&0x80 > 0
+		if !apu.ch3.dacEnabled {
+			apu.ch3.enabled = false
+		}
+	case 0xff1b:
+		apu.ch3.length.counter = 256 - uint16(val)
+	case 0xff1c:
+		apu.ch3.volumeCode = val >> 5 & 0x3
+	case 0xff1d:
+		apu.ch3.freq = apu.ch3.freq&0x700 | uint16(val)
+	case 0xff1e:
+		apu.ch3.writeFreqHi(val)
+
+	// channel 4
+	case 0xff20:
+		apu.ch4.length.counter = 64 - uint16(val&0x3f)
+	case 0xff21:
+		apu.ch4.envelope.write(val)
+		if !apu.ch4.envelope.isDACEnabled() {
+			apu.ch4.enabled = false
+		}
+	case 0xff22:
+		apu.ch4.writePoly(val)
+	case 0xff23:
+		apu.ch4.writeControl(val)
+
+	// control
+	case 0xff24:
+		apu.nr50 = val
+	case 0xff25:
+		apu.nr51 = val
+	}
+}
+
+func (apu *APU) writeStatus(val uint8) {
+	enabled := val&0x80 > 0
+
+	if apu.enabled && !enabled {
+		// powering off clears every register except wave RAM
+		for addr := uint16(0xff10); addr <= 0xff25; addr++ {
+			apu.Write(addr, 0)
+		}
+	}
+
+	if !apu.enabled && enabled {
+		apu.frameSequencerStep = 0
+	}
+
+	apu.enabled = enabled
+}
+
+// clockFrameSequencer steps the 512Hz sequencer
+//
+// Step   Length Ctr  Vol Env     Sweep
+// ---------------------------------------
+// 0      Clock       -           -
+// 1      -           -           -
+// 2      Clock       -           Clock
+// 3      -           -           -
+// 4      Clock       -           -
+// 5      -           -           -
+// 6      Clock       -           Clock
+// 7      -           Clock       -
+// reference: https://gbdev.gg8.se/wiki/articles/Gameboy_sound_hardware
+func (apu *APU) clockFrameSequencer() {
+	step := apu.frameSequencerStep
+
+	if step%2 == 0 {
+		apu.ch1.enabled = apu.ch1.length.clock() && apu.ch1.enabled
+		apu.ch2.enabled = apu.ch2.length.clock() && apu.ch2.enabled
+		apu.ch3.enabled = apu.ch3.length.clock() && apu.ch3.enabled
+		apu.ch4.enabled = apu.ch4.length.clock() && apu.ch4.enabled
+	}
+
+	if step == 2 || step == 6 {
+		apu.ch1.clockSweep()
+	}
+
+	if step == 7 {
+		apu.ch1.envelope.clock()
+		apu.ch2.envelope.clock()
+		apu.ch4.envelope.clock()
+	}
+
+	apu.frameSequencerStep = (step + 1) & 0x7
+}
+
+// mix returns the left and right output.
+// each channel outputs 0-15, which is converted into -15 to 15 by its DAC
+// and then amplified by the master volume (1-8)
+func (apu *APU) mix() (int16, int16) {
+	outputs := [4]uint8{apu.ch1.output(), apu.ch2.output(), apu.ch3.output(), apu.ch4.output()}
+	dacs := [4]bool{
+		apu.ch1.envelope.isDACEnabled(),
+		apu.ch2.envelope.isDACEnabled(),
+		apu.ch3.dacEnabled,
+		apu.ch4.envelope.isDACEnabled(),
+	}
+
+	var left, right int32
+	for i := 0; i < 4; i++ {
+		if !dacs[i] {
+			continue
+		}
+
+		sample := int32(outputs[i])*2 - 15
+
+		// NR51 bit 7-4 for left, bit 3-0 for right
+		if apu.nr51>>(4+i)&1 == 1 {
+			left += sample
+		}
+		if apu.nr51>>i&1 == 1 {
+			right += sample
+		}
+	}
+
+	left *= int32(apu.nr50>>4&0x7) + 1
+	right *= int32(apu.nr50&0x7) + 1
+
+	// 4 channels * 15 * 8 = 480 at most
+	return int16(left * 64), int16(right * 64)
+}
+
+func (apu *APU) Update(ticks uint8) {
+	for i := 0; i < int(ticks); i++ {
+		if apu.enabled {
+			apu.frameSequencerCounter++
+			if apu.frameSequencerCounter >= frameSequencerPeriod {
+				apu.frameSequencerCounter -= frameSequencerPeriod
+				apu.clockFrameSequencer()
+			}
+
+			apu.ch1.step()
+			apu.ch2.step()
+			apu.ch3.step()
+			apu.ch4.step()
+		}
+
+		// downsample 4194304Hz to SampleRate
+		apu.sampleCounter += SampleRate
+		if apu.sampleCounter >= cpuClock {
+			apu.sampleCounter -= cpuClock
+
+			if apu.enabled {
+				apu.Buffer.push(apu.mix())
+			} else {
+				apu.Buffer.push(0, 0)
+			}
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package apu
+
+import "sync"
+
+// Buffer is a ring buffer of interleaved stereo samples (left, right).
+// The emulator pushes into it while the frontend drains it, possibly from
+// another goroutine, so every access is guarded by a mutex.
+type Buffer struct {
+	mu sync.Mutex
+
+	samples []int16
+	readPos int
+	count   int
+}
+
+// NewBuffer returns a buffer that can hold size stereo frames
+func NewBuffer(size int) *Buffer {
+	return &Buffer{samples: make([]int16, size*2)}
+}
+
+func (buf *Buffer) push(left, right int16) {
+	buf.mu.Lock()
+	defer buf.mu.Unlock()
+
+	// when the frontend can't keep up, drop the oldest frame
+	if buf.count == len(buf.samples) {
+		buf.readPos = (buf.readPos + 2) % len(buf.samples)
+		buf.count -= 2
+	}
+
+	writePos := (buf.readPos + buf.count) % len(buf.samples)
+	buf.samples[writePos] = left
+	buf.samples[writePos+1] = right
+	buf.count += 2
+}
+
+// Len returns the number of stereo frames waiting in the buffer
+func (buf *Buffer) Len() int {
+	buf.mu.Lock()
+	defer buf.mu.Unlock()
+
+	return buf.count / 2
+}
+
+// Drain copies interleaved samples into dst and returns how many were copied.
+// Only whole stereo frames are copied.
+func (buf *Buffer) Drain(dst []int16) int {
+	buf.mu.Lock()
+	defer buf.mu.Unlock()
+
+	n := len(dst) &^ 1
+	if n > buf.count {
+		n = buf.count
+	}
+
+	for i := 0; i < n; i++ {
+		dst[i] = buf.samples[buf.readPos]
+		buf.readPos = (buf.readPos + 1) % len(buf.samples)
+	}
+	buf.count -= n
+
+	return n
+}
+
+// Read implements io.Reader and returns 16-bit little endian stereo PCM,
+// which is what ebiten's audio player expects.
+// If the emulator falls behind, the rest of p is filled with silence
+// so that playback never blocks.
+func (buf *Buffer) Read(p []byte) (int, error) {
+	n := len(p) &^ 3
+
+	samples := make([]int16, n/2)
+	buf.Drain(samples)
+
+	for i, s := range samples {
+		p[i*2] = uint8(s)
+		p[i*2+1] = uint8(uint16(s) >> 8)
+	}
+
+	return n, nil
+}
+
+// Close does nothing. It lets the buffer be used as an io.ReadCloser
+func (buf *Buffer) Close() error {
+	return nil
+}
@@ -0,0 +1,388 @@
+package apu
+
+// duty cycle waveforms of the square channels
+// 12.5%, 25%, 50%, 75%
+var dutyTable = [4][8]uint8{
+	{0, 0, 0, 0, 0, 0, 0, 1},
+	{1, 0, 0, 0, 0, 0, 0, 1},
+	{1, 0, 0, 0, 0, 1, 1, 1},
+	{0, 1, 1, 1, 1, 1, 1, 0},
+}
+
+// divisors of the noise channel selected by NR43 bit 2-0
+var noiseDivisors = [8]uint16{8, 16, 32, 48, 64, 80, 96, 112}
+
+// length counter shared by all channels
+type length struct {
+	counter uint16
+	enabled bool
+}
+
+// clock returns false when the channel must be turned off
+func (l *length) clock() bool {
+	if !l.enabled || l.counter == 0 {
+		return true
+	}
+
+	l.counter--
+	return l.counter > 0
+}
+
+// volume envelope shared by the square and noise channels
+type envelope struct {
+	initial  uint8 // NRx2 bit 7-4
+	increase bool  // NRx2 bit 3
+	period   uint8 // NRx2 bit 2-0
+
+	volume uint8
+	timer  uint8
+}
+
+func (env *envelope) write(val uint8) {
+	env.initial = val >> 4
+	env.increase = val&0x8 > 0
+	env.period = val & 0x7
+}
+
+func (env *envelope) read() uint8 {
+	val := env.initial<<4 | env.period
+	if env.increase {
+		val |= 0x8
+	}
+	return val
+}
+
+// the DAC is powered as long as any of NRx2 bit 7-3 is set
+func (env *envelope) isDACEnabled() bool {
+	return env.read()&0xf8 > 0
+}
+
+func (env *envelope) trigger() {
+	env.volume = env.initial
+	env.timer = env.period
+}
+
+func (env *envelope) clock() {
+	if env.period == 0 {
+		return
+	}
+
+	if env.timer > 0 {
+		env.timer--
+	}
+	if env.timer > 0 {
+		return
+	}
+	env.timer = env.period
+
+	if env.increase && env.volume < 15 {
+		env.volume++
+	} else if !env.increase && env.volume > 0 {
+		env.volume--
+	}
+}
+
+//======================================================================
+// Channel 1 & 2: square wave
+//======================================================================
+
+type square struct {
+	enabled bool
+
+	// frequency sweep. only channel 1 has it
+	hasSweep     bool
+	sweepPeriod  uint8 // NR10 bit 6-4
+	sweepNegate  bool  // NR10 bit 3
+	sweepShift   uint8 // NR10 bit 2-0
+	sweepTimer   uint8
+	sweepEnabled bool
+	shadowFreq   uint16
+
+	duty     uint8 // NRx1 bit 7-6
+	dutyStep uint8
+
+	length   length
+	envelope envelope
+
+	freq      uint16 // NRx3 and NRx4 bit 2-0
+	freqTimer uint16
+}
+
+func (ch *square) readSweep() uint8 {
+	val := ch.sweepPeriod<<4 | ch.sweepShift
+	if ch.sweepNegate {
+		val |= 0x8
+	}
+	return val | 0x80
+}
+
+func (ch *square) writeSweep(val uint8) {
+	ch.sweepPeriod = val >> 4 & 0x7
+	ch.sweepNegate = val&0x8 > 0
+	ch.sweepShift = val & 0x7
+}
+
+func (ch *square) writeLength(val uint8) {
+	ch.duty = val >> 6
+	ch.length.counter = 64 - uint16(val&0x3f)
+}
+
+func (ch *square) writeFreqHi(val uint8) {
+	ch.freq = ch.freq&0xff | uint16(val&0x7)<<8
+	ch.length.enabled = val&0x40 > 0
+
+	if val&0x80 > 0 {
+		ch.trigger()
+	}
+}
+
+func (ch *square) trigger() {
+	ch.enabled = ch.envelope.isDACEnabled()
+
+	if ch.length.counter == 0 {
+		ch.length.counter = 64
+	}
+
+	ch.freqTimer = (2048 - ch.freq) * 4
+	ch.envelope.trigger()
+
+	if !ch.hasSweep {
+		return
+	}
+
+	ch.shadowFreq = ch.freq
+	ch.sweepTimer = ch.sweepPeriod
+	if ch.sweepTimer == 0 {
+		ch.sweepTimer = 8
+	}
+	ch.sweepEnabled = ch.sweepPeriod > 0 || ch.sweepShift > 0
+
+	// overflow check is done immediately if shift is non-zero
+	if ch.sweepShift > 0 {
+		ch.calcSweep()
+	}
+}
+
+// calcSweep calculates the next frequency and disables the channel on overflow
+func (ch *square) calcSweep() uint16 {
+	delta := ch.shadowFreq >> ch.sweepShift
+
+	var freq uint16
+	if ch.sweepNegate {
+		freq = ch.shadowFreq - delta
+	} else {
+		freq = ch.shadowFreq + delta
+	}
+
+	if freq > 2047 {
+		ch.enabled = false
+	}
+
+	return freq
+}
+
+func (ch *square) clockSweep() {
+	if ch.sweepTimer > 0 {
+		ch.sweepTimer--
+	}
+	if ch.sweepTimer > 0 {
+		return
+	}
+
+	ch.sweepTimer = ch.sweepPeriod
+	if ch.sweepTimer == 0 {
+		ch.sweepTimer = 8
+	}
+
+	if !ch.sweepEnabled || ch.sweepPeriod == 0 {
+		return
+	}
+
+	freq := ch.calcSweep()
+	if freq <= 2047 && ch.sweepShift > 0 {
+		ch.freq = freq
+		ch.shadowFreq = freq
+		ch.calcSweep()
+	}
+}
+
+func (ch *square) step() {
+	if ch.freqTimer > 0 {
+		ch.freqTimer--
+	}
+	if ch.freqTimer > 0 {
+		return
+	}
+
+	ch.freqTimer = (2048 - ch.freq) * 4
+	ch.dutyStep = (ch.dutyStep + 1) & 0x7
+}
+
+func (ch *square) output() uint8 {
+	if !ch.enabled {
+		return 0
+	}
+	return dutyTable[ch.duty][ch.dutyStep] * ch.envelope.volume
+}
+
+//======================================================================
+// Channel 3: wave output
+//======================================================================
+
+type wave struct {
+	enabled    bool
+	dacEnabled bool // NR30 bit 7
+
+	length     length
+	volumeCode uint8 // NR32 bit 6-5
+
+	freq      uint16
+	freqTimer uint16
+
+	// 32 4-bit samples at 0xff30-0xff3f
+	ram      [16]uint8
+	position uint8
+}
+
+func (ch *wave) writeFreqHi(val uint8) {
+	ch.freq = ch.freq&0xff | uint16(val&0x7)<<8
+	ch.length.enabled = val&0x40 > 0
+
+	if val&0x80 > 0 {
+		ch.trigger()
+	}
+}
+
+func (ch *wave) trigger() {
+	ch.enabled = ch.dacEnabled
+
+	if ch.length.counter == 0 {
+		ch.length.counter = 256
+	}
+
+	ch.freqTimer = (2048 - ch.freq) * 2
+	ch.position = 0
+}
+
+func (ch *wave) step() {
+	if ch.freqTimer > 0 {
+		ch.freqTimer--
+	}
+	if ch.freqTimer > 0 {
+		return
+	}
+
+	ch.freqTimer = (2048 - ch.freq) * 2
+	ch.position = (ch.position + 1) & 0x1f
+}
+
+func (ch *wave) output() uint8 {
+	if !ch.enabled {
+		return 0
+	}
+
+	// upper 4 bits are played first
+	sample := ch.ram[ch.position/2]
+	if ch.position%2 == 0 {
+		sample >>= 4
+	}
+	sample &= 0xf
+
+	switch ch.volumeCode {
+	case 0:
+		return 0
+	case 1:
+		return sample
+	case 2:
+		return sample >> 1
+	case 3:
+		return sample >> 2
+	}
+
+	return 0
+}
+
+//======================================================================
+// Channel 4: noise
+//======================================================================
+
+type noise struct {
+	enabled bool
+
+	length   length
+	envelope envelope
+
+	shift     uint8 // NR43 bit 7-4
+	widthMode bool  // NR43 bit 3. 7-bit LFSR when set
+	divisor   uint8 // NR43 bit 2-0
+
+	lfsr      uint16
+	freqTimer uint32
+}
+
+func (ch *noise) readPoly() uint8 {
+	val := ch.shift<<4 | ch.divisor
+	if ch.widthMode {
+		val |= 0x8
+	}
+	return val
+}
+
+func (ch *noise) writePoly(val uint8) {
+	ch.shift = val >> 4
+	ch.widthMode = val&0x8 > 0
+	ch.divisor = val & 0x7
+}
+
+func (ch *noise) period() uint32 {
+	return uint32(noiseDivisors[ch.divisor]) << ch.shift
+}
+
+func (ch *noise) writeControl(val uint8) {
+	ch.length.enabled = val&0x40 > 0
+
+	if val&0x80 > 0 {
+		ch.trigger()
+	}
+}
+
+func (ch *noise) trigger() {
+	ch.enabled = ch.envelope.isDACEnabled()
+
+	if ch.length.counter == 0 {
+		ch.length.counter = 64
+	}
+
+	ch.freqTimer = ch.period()
+	ch.envelope.trigger()
+	ch.lfsr = 0x7fff
+}
+
+func (ch *noise) step() {
+	if ch.freqTimer > 0 {
+		ch.freqTimer--
+	}
+	if ch.freqTimer > 0 {
+		return
+	}
+
+	ch.freqTimer = ch.period()
+
+	xor := (ch.lfsr & 1) ^ (ch.lfsr >> 1 & 1)
+	ch.lfsr = ch.lfsr>>1 | xor<<14
+	if ch.widthMode {
+		ch.lfsr = ch.lfsr&^(1<<6) | xor<<6
+	}
+}
+
+func (ch *noise) output() uint8 {
+	if !ch.enabled {
+		return 0
+	}
+
+	// output is the inverted bit 0 of LFSR
+	if ch.lfsr&1 == 0 {
+		return ch.envelope.volume
+	}
+	return 0
+}
@@ -0,0 +1,67 @@
+package apu
+
+import (
+	"gbemu/utils"
+	"io"
+)
+
+func (l *length) stateFields() []interface{} {
+	return []interface{}{&l.counter, &l.enabled}
+}
+
+func (env *envelope) stateFields() []interface{} {
+	return []interface{}{&env.initial, &env.increase, &env.period, &env.volume, &env.timer}
+}
+
+func (ch *square) stateFields() []interface{} {
+	fields := []interface{}{
+		&ch.enabled,
+		&ch.sweepPeriod, &ch.sweepNegate, &ch.sweepShift, &ch.sweepTimer, &ch.sweepEnabled, &ch.shadowFreq,
+		&ch.duty, &ch.dutyStep,
+		&ch.freq, &ch.freqTimer,
+	}
+	fields = append(fields, ch.length.stateFields()...)
+	return append(fields, ch.envelope.stateFields()...)
+}
+
+func (ch *wave) stateFields() []interface{} {
+	fields := []interface{}{
+		&ch.enabled, &ch.dacEnabled, &ch.volumeCode,
+		&ch.freq, &ch.freqTimer,
+		ch.ram[:], &ch.position,
+	}
+	return append(fields, ch.length.stateFields()...)
+}
+
+func (ch *noise) stateFields() []interface{} {
+	fields := []interface{}{
+		&ch.enabled,
+		&ch.shift, &ch.widthMode, &ch.divisor,
+		&ch.lfsr, &ch.freqTimer,
+	}
+	fields = append(fields, ch.length.stateFields()...)
+	return append(fields, ch.envelope.stateFields()...)
+}
+
+func (apu *APU) stateFields() []interface{} {
+	fields := []interface{}{
+		&apu.nr50, &apu.nr51, &apu.enabled,
+		&apu.frameSequencerCounter, &apu.frameSequencerStep,
+		&apu.sampleCounter,
+	}
+	fields = append(fields, apu.ch1.stateFields()...)
+	fields = append(fields, apu.ch2.stateFields()...)
+	fields = append(fields, apu.ch3.stateFields()...)
+	return append(fields, apu.ch4.stateFields()...)
+}
+
+// SaveState writes the sound registers, wave RAM and channel counters.
+// Samples waiting in Buffer are not included.
+func (apu *APU) SaveState(w io.Writer) error {
+	return utils.WriteState(w, apu.stateFields())
+}
+
+// LoadState restores the state written by SaveState
+func (apu *APU) LoadState(r io.Reader) error {
+	return utils.ReadState(r, apu.stateFields())
+}
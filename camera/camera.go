@@ -0,0 +1,157 @@
+package camera
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	// register PNG decoder
+	_ "image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// size of the image captured by the Game Boy Camera
+const (
+	Width  = 128
+	Height = 112
+)
+
+// Frame is a grayscale image of Width x Height. 0 is black and 255 is white
+type Frame [Width * Height]uint8
+
+// Source provides images to the sensor of the Game Boy Camera
+type Source interface {
+	// Frame returns the image seen by the sensor now
+	Frame() *Frame
+}
+
+// NewSource returns a source for path.
+// A directory plays its PNG files in name order and a file is used as a still image.
+func NewSource(path string) (Source, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return NewDirSource(path)
+	}
+	return NewImageSource(path)
+}
+
+// ImageSource always returns the same image
+type ImageSource struct {
+	frame *Frame
+}
+
+// NewImageSource loads a PNG file and scales it to the camera size
+func NewImageSource(path string) (*ImageSource, error) {
+	frame, err := loadFrame(path)
+	if err != nil {
+		return nil, err
+	}
+	return &ImageSource{frame: frame}, nil
+}
+
+func (src *ImageSource) Frame() *Frame {
+	return src.frame
+}
+
+// DirSource returns the PNG files in a directory one by one and loops
+type DirSource struct {
+	frames []*Frame
+	next   int
+}
+
+// NewDirSource loads all the PNG files in dir
+func NewDirSource(dir string) (*DirSource, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, file := range files {
+		if !file.IsDir() && strings.EqualFold(filepath.Ext(file.Name()), ".png") {
+			names = append(names, file.Name())
+		}
+	}
+	sort.Strings(names)
+
+	if len(names) == 0 {
+		return nil, fmt.Errorf("camera: no PNG files in %s", dir)
+	}
+
+	src := &DirSource{}
+	for _, name := range names {
+		frame, err := loadFrame(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		src.frames = append(src.frames, frame)
+	}
+	return src, nil
+}
+
+func (src *DirSource) Frame() *Frame {
+	frame := src.frames[src.next]
+	src.next = (src.next + 1) % len(src.frames)
+	return frame
+}
+
+// TestPattern is a generated source for machines without images.
+// Vertical gray bars with a checkerboard moving to the right.
+type TestPattern struct {
+	frame Frame
+	count int
+}
+
+func NewTestPattern() *TestPattern {
+	return &TestPattern{}
+}
+
+func (src *TestPattern) Frame() *Frame {
+	for y := 0; y < Height; y++ {
+		for x := 0; x < Width; x++ {
+			var val uint8
+			if y < Height/2 {
+				// 4 bars from white to black
+				val = uint8(255 - x/(Width/4)*85)
+			} else if ((x+src.count)/16+y/16)%2 == 0 {
+				val = 255
+			}
+			src.frame[y*Width+x] = val
+		}
+	}
+	src.count++
+
+	return &src.frame
+}
+
+// loadFrame decodes an image file and scales it to Width x Height with nearest neighbor
+func loadFrame(path string) (*Frame, error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	img, _, err := image.Decode(fp)
+	if err != nil {
+		return nil, fmt.Errorf("camera: %s: %v", path, err)
+	}
+
+	bounds := img.Bounds()
+	frame := &Frame{}
+	for y := 0; y < Height; y++ {
+		for x := 0; x < Width; x++ {
+			srcX := bounds.Min.X + x*bounds.Dx()/Width
+			srcY := bounds.Min.Y + y*bounds.Dy()/Height
+			gray := color.GrayModel.Convert(img.At(srcX, srcY)).(color.Gray)
+			frame[y*Width+x] = gray.Y
+		}
+	}
+	return frame, nil
+}
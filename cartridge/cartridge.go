@@ -0,0 +1,309 @@
+package cartridge
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Mapper is the memory bank controller chip on the cartridge
+type Mapper uint8
+
+const (
+	ROMOnly Mapper = iota
+	MBC1
+	MBC2
+	MMM01
+	MBC3
+	MBC5
+	MBC6
+	MBC7
+	PocketCamera
+	TAMA5
+	HuC3
+	HuC1
+)
+
+var mapperNames = map[Mapper]string{
+	ROMOnly:      "ROM ONLY",
+	MBC1:         "MBC1",
+	MBC2:         "MBC2",
+	MMM01:        "MMM01",
+	MBC3:         "MBC3",
+	MBC5:         "MBC5",
+	MBC6:         "MBC6",
+	MBC7:         "MBC7",
+	PocketCamera: "POCKET CAMERA",
+	TAMA5:        "BANDAI TAMA5",
+	HuC3:         "HuC3",
+	HuC1:         "HuC1",
+}
+
+func (mapper Mapper) String() string {
+	return mapperNames[mapper]
+}
+
+// cartridgeType describes the hardware in the cartridge.
+type cartridgeType struct {
+	mapper  Mapper
+	ram     bool
+	battery bool
+	timer   bool
+	rumble  bool
+}
+
+// cartridge types by the header byte 0x147
+var cartridgeTypes = map[uint8]cartridgeType{
+	0x00: {mapper: ROMOnly},
+	0x01: {mapper: MBC1},
+	0x02: {mapper: MBC1, ram: true},
+	0x03: {mapper: MBC1, ram: true, battery: true},
+	0x05: {mapper: MBC2},
+	0x06: {mapper: MBC2, battery: true},
+	0x08: {mapper: ROMOnly, ram: true},
+	0x09: {mapper: ROMOnly, ram: true, battery: true},
+	0x0b: {mapper: MMM01},
+	0x0c: {mapper: MMM01, ram: true},
+	0x0d: {mapper: MMM01, ram: true, battery: true},
+	0x0f: {mapper: MBC3, timer: true, battery: true},
+	0x10: {mapper: MBC3, timer: true, ram: true, battery: true},
+	0x11: {mapper: MBC3},
+	0x12: {mapper: MBC3, ram: true},
+	0x13: {mapper: MBC3, ram: true, battery: true},
+	0x19: {mapper: MBC5},
+	0x1a: {mapper: MBC5, ram: true},
+	0x1b: {mapper: MBC5, ram: true, battery: true},
+	0x1c: {mapper: MBC5, rumble: true},
+	0x1d: {mapper: MBC5, rumble: true, ram: true},
+	0x1e: {mapper: MBC5, rumble: true, ram: true, battery: true},
+	0x20: {mapper: MBC6, ram: true, battery: true},
+	0x22: {mapper: MBC7, rumble: true, ram: true, battery: true},
+	0xfc: {mapper: PocketCamera, ram: true, battery: true},
+	0xfd: {mapper: TAMA5, ram: true, battery: true},
+	0xfe: {mapper: HuC3, timer: true, ram: true, battery: true},
+	0xff: {mapper: HuC1, ram: true, battery: true},
+}
+
+// Header is the cartridge header at 0x0100-0x014f
+// reference: https://gbdev.io/pandocs/The_Cartridge_Header.html
+type Header struct {
+	Title            string   // 0x134-0x143. 0x134-0x13e on newer cartridges
+	RawTitle         [16]byte // 0x134-0x143 as is. the CGB boot ROM uses it to pick palettes
+	ManufacturerCode string   // 0x13f-0x142. empty on older cartridges
+	CGBFlag          uint8    // 0x143
+	NewLicenseeCode  string   // 0x144-0x145
+	SGBFlag          uint8    // 0x146
+	CartridgeType    uint8    // 0x147
+	ROMSizeCode      uint8    // 0x148
+	RAMSizeCode      uint8    // 0x149
+	Destination      uint8    // 0x14a. 0 = Japanese, 1 = Non-Japanese
+	OldLicenseeCode  uint8    // 0x14b
+	Version          uint8    // 0x14c
+	HeaderChecksum   uint8    // 0x14d
+	GlobalChecksum   uint16   // 0x14e-0x14f. big endian
+}
+
+const headerEnd = 0x150
+
+// Parse parses the header of rom.
+// If the header is readable but something is wrong with it, Parse returns
+// both the header and an error so that the caller can decide whether to go on.
+// The error is one of *TruncatedError, *UnsupportedMapperError or *ChecksumError,
+// or Errors holding several of them. Use errors.As to look for each.
+func Parse(rom []byte) (*Header, error) {
+	if len(rom) < headerEnd {
+		return nil, &TruncatedError{Size: len(rom), Want: headerEnd}
+	}
+
+	header := &Header{
+		CGBFlag:         rom[0x143],
+		NewLicenseeCode: string(rom[0x144:0x146]),
+		SGBFlag:         rom[0x146],
+		CartridgeType:   rom[0x147],
+		ROMSizeCode:     rom[0x148],
+		RAMSizeCode:     rom[0x149],
+		Destination:     rom[0x14a],
+		OldLicenseeCode: rom[0x14b],
+		Version:         rom[0x14c],
+		HeaderChecksum:  rom[0x14d],
+		GlobalChecksum:  uint16(rom[0x14e])<<8 | uint16(rom[0x14f]),
+	}
+
+	copy(header.RawTitle[:], rom[0x134:0x144])
+
+	if header.CGBFlag&0x80 > 0 {
+		// on CGB cartridges the title is shortened to hold the manufacturer code and the CGB flag
+		header.Title = parseString(rom[0x134:0x13f])
+		header.ManufacturerCode = parseString(rom[0x13f:0x143])
+	} else {
+		header.Title = parseString(rom[0x134:0x144])
+	}
+
+	// all the checks run so that a bad dump isn't reported only as an unknown type
+	var errs Errors
+
+	truncated := header.ROMSize() > len(rom)
+	if truncated {
+		errs = append(errs, &TruncatedError{Size: len(rom), Want: header.ROMSize()})
+	}
+
+	if sum := headerChecksum(rom); sum != header.HeaderChecksum {
+		errs = append(errs, &ChecksumError{Kind: "header", Want: uint16(header.HeaderChecksum), Got: uint16(sum)})
+	}
+
+	// the global checksum of a truncated ROM means nothing
+	if sum := globalChecksum(rom); !truncated && sum != header.GlobalChecksum {
+		errs = append(errs, &ChecksumError{Kind: "global", Want: header.GlobalChecksum, Got: sum})
+	}
+
+	if _, ok := cartridgeTypes[header.CartridgeType]; !ok {
+		errs = append(errs, &UnsupportedMapperError{Type: header.CartridgeType})
+	}
+
+	return header, errs.err()
+}
+
+// parseString trims NUL padding and non-ASCII characters
+func parseString(data []byte) string {
+	var sb strings.Builder
+	for _, c := range data {
+		if c == 0 {
+			break
+		}
+		if c < 0x20 || c > 0x7e {
+			continue
+		}
+		sb.WriteByte(c)
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// headerChecksum is the same calculation as the boot ROM does
+// x = 0: FOR i = 0134h TO 014Ch: x = x - MEM[i] - 1: NEXT
+func headerChecksum(rom []byte) uint8 {
+	var x uint8
+	for i := 0x134; i <= 0x14c; i++ {
+		x = x - rom[i] - 1
+	}
+	return x
+}
+
+// globalChecksum sums all bytes of the ROM except the checksum itself
+func globalChecksum(rom []byte) uint16 {
+	var sum uint16
+	for i, b := range rom {
+		if i == 0x14e || i == 0x14f {
+			continue
+		}
+		sum += uint16(b)
+	}
+	return sum
+}
+
+// Mapper returns the memory bank controller. ROMOnly for unknown types
+func (header *Header) Mapper() Mapper {
+	return cartridgeTypes[header.CartridgeType].mapper
+}
+
+// HasRAM reports whether the cartridge has external RAM
+func (header *Header) HasRAM() bool {
+	return cartridgeTypes[header.CartridgeType].ram
+}
+
+// HasBattery reports whether the cartridge RAM (or clock) keeps its contents without power
+func (header *Header) HasBattery() bool {
+	return cartridgeTypes[header.CartridgeType].battery
+}
+
+// HasTimer reports whether the cartridge has a real-time clock
+func (header *Header) HasTimer() bool {
+	return cartridgeTypes[header.CartridgeType].timer
+}
+
+// HasRumble reports whether the cartridge has a rumble motor
+func (header *Header) HasRumble() bool {
+	return cartridgeTypes[header.CartridgeType].rumble
+}
+
+// ROMSize returns the ROM size in bytes from 0x148
+func (header *Header) ROMSize() int {
+	switch header.ROMSizeCode {
+	case 0x52:
+		return 72 * 0x4000
+	case 0x53:
+		return 80 * 0x4000
+	case 0x54:
+		return 96 * 0x4000
+	}
+
+	if header.ROMSizeCode <= 0x08 {
+		// 32KB << N
+		return 0x8000 << header.ROMSizeCode
+	}
+
+	return 0x8000
+}
+
+// ROMBanks returns the number of 16KB ROM banks
+func (header *Header) ROMBanks() int {
+	return header.ROMSize() / 0x4000
+}
+
+// RAMSize returns the external RAM size in bytes from 0x149
+func (header *Header) RAMSize() int {
+	switch header.RAMSizeCode {
+	case 0x01:
+		return 0x800 // 2KB
+	case 0x02:
+		return 0x2000 // 8KB
+	case 0x03:
+		return 0x8000 // 32KB, 4 banks
+	case 0x04:
+		return 0x20000 // 128KB, 16 banks
+	case 0x05:
+		return 0x10000 // 64KB, 8 banks
+	}
+	return 0
+}
+
+// IsCGBOnly reports whether the game works only on CGB. 0x143 = 0xc0
+func (header *Header) IsCGBOnly() bool {
+	return header.CGBFlag == 0xc0
+}
+
+// SupportsCGB reports whether the game uses CGB functions. 0x143 = 0x80 or 0xc0
+func (header *Header) SupportsCGB() bool {
+	return header.CGBFlag == 0x80 || header.CGBFlag == 0xc0
+}
+
+// SupportsSGB reports whether the game uses SGB functions. 0x146 = 0x03
+func (header *Header) SupportsSGB() bool {
+	return header.SGBFlag == 0x03
+}
+
+// TypeName returns the cartridge type as written in Pan Docs. e.g. "MBC1+RAM+BATTERY"
+func (header *Header) TypeName() string {
+	info, ok := cartridgeTypes[header.CartridgeType]
+	if !ok {
+		return fmt.Sprintf("UNKNOWN(%#02x)", header.CartridgeType)
+	}
+
+	name := info.mapper.String()
+	if info.timer {
+		name += "+TIMER"
+	}
+	if info.rumble {
+		name += "+RUMBLE"
+	}
+	if info.ram {
+		name += "+RAM"
+	}
+	if info.battery {
+		name += "+BATTERY"
+	}
+	return name
+}
+
+func (header *Header) String() string {
+	return fmt.Sprintf("%s (%s, ROM %dKB, RAM %dKB)",
+		header.Title, header.TypeName(), header.ROMSize()/1024, header.RAMSize()/1024)
+}
@@ -0,0 +1,141 @@
+package cartridge
+
+import (
+	"errors"
+	"testing"
+)
+
+// testROM returns a 32KB ROM with the header checksums fixed up after fn edits it
+func testROM(fn func(rom []byte)) []byte {
+	rom := make([]byte, 0x8000)
+	copy(rom[0x134:], "TESTGAME")
+	rom[0x147] = 0x01 // MBC1
+
+	if fn != nil {
+		fn(rom)
+	}
+
+	rom[0x14d] = headerChecksum(rom)
+	sum := globalChecksum(rom)
+	rom[0x14e], rom[0x14f] = uint8(sum>>8), uint8(sum)
+	return rom
+}
+
+func TestParse(t *testing.T) {
+	header, err := Parse(testROM(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if header.Title != "TESTGAME" || header.Mapper() != MBC1 || header.ROMSize() != 0x8000 {
+		t.Errorf("header = %q %v %d bytes, want \"TESTGAME\" MBC1 32768 bytes",
+			header.Title, header.Mapper(), header.ROMSize())
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name         string
+		rom          []byte
+		truncated    bool
+		checksums    []string // kinds of the bad checksums
+		unsupported  bool
+		wantNoHeader bool
+	}{
+		{
+			name:         "too small for a header",
+			rom:          make([]byte, 0x100),
+			truncated:    true,
+			wantNoHeader: true,
+		},
+		{
+			name:      "truncated",
+			rom:       testROM(func(rom []byte) { rom[0x148] = 0x01 }),
+			truncated: true,
+		},
+		{
+			name: "bad header checksum",
+			rom: func() []byte {
+				rom := testROM(nil)
+				rom[0x14d]++
+				return rom
+			}(),
+			// the header checksum is covered by the global checksum
+			checksums: []string{"header", "global"},
+		},
+		{
+			name: "bad global checksum",
+			rom: func() []byte {
+				rom := testROM(nil)
+				rom[0x4000]++
+				return rom
+			}(),
+			checksums: []string{"global"},
+		},
+		{
+			name:        "unknown type",
+			rom:         testROM(func(rom []byte) { rom[0x147] = 0x2a }),
+			unsupported: true,
+		},
+		{
+			name: "unknown type of a corrupt ROM",
+			rom: func() []byte {
+				rom := testROM(func(rom []byte) { rom[0x147] = 0x2a })
+				rom[0x4000]++
+				return rom
+			}(),
+			checksums:   []string{"global"},
+			unsupported: true,
+		},
+		{
+			name:        "unknown type of a truncated ROM",
+			rom:         testROM(func(rom []byte) { rom[0x147], rom[0x148] = 0x2a, 0x02 }),
+			truncated:   true,
+			unsupported: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header, err := Parse(tt.rom)
+			if (header == nil) != tt.wantNoHeader {
+				t.Errorf("header = %v, want nil: %v", header, tt.wantNoHeader)
+			}
+
+			var truncatedErr *TruncatedError
+			if got := errors.As(err, &truncatedErr); got != tt.truncated {
+				t.Errorf("TruncatedError found: %v, want %v (err: %v)", got, tt.truncated, err)
+			}
+
+			var unsupportedErr *UnsupportedMapperError
+			if got := errors.As(err, &unsupportedErr); got != tt.unsupported {
+				t.Errorf("UnsupportedMapperError found: %v, want %v (err: %v)", got, tt.unsupported, err)
+			}
+
+			var checksumErr *ChecksumError
+			if got := errors.As(err, &checksumErr); got != (len(tt.checksums) > 0) {
+				t.Errorf("ChecksumError found: %v, want %v (err: %v)", got, len(tt.checksums) > 0, err)
+			}
+
+			// each kind of the bad checksums is in the error
+			var kinds []string
+			if errs, ok := err.(Errors); ok {
+				for _, err := range errs {
+					if checksumErr, ok := err.(*ChecksumError); ok {
+						kinds = append(kinds, checksumErr.Kind)
+					}
+				}
+			} else if checksumErr != nil {
+				kinds = []string{checksumErr.Kind}
+			}
+			if len(kinds) != len(tt.checksums) {
+				t.Errorf("bad checksums %v, want %v", kinds, tt.checksums)
+			}
+			for i := range kinds {
+				if i < len(tt.checksums) && kinds[i] != tt.checksums[i] {
+					t.Errorf("bad checksums %v, want %v", kinds, tt.checksums)
+				}
+			}
+		})
+	}
+}
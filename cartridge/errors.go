@@ -0,0 +1,75 @@
+package cartridge
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// TruncatedError is returned when the ROM is smaller than the header says
+// or too small to contain a header at all
+type TruncatedError struct {
+	Size int
+	Want int
+}
+
+func (e *TruncatedError) Error() string {
+	return fmt.Sprintf("cartridge: ROM is truncated: %d bytes, want %d bytes", e.Size, e.Want)
+}
+
+// UnsupportedMapperError is returned for a cartridge type that can't be emulated
+type UnsupportedMapperError struct {
+	Type uint8
+}
+
+func (e *UnsupportedMapperError) Error() string {
+	if info, ok := cartridgeTypes[e.Type]; ok {
+		return fmt.Sprintf("cartridge: unsupported mapper %s (type %#02x)", info.mapper, e.Type)
+	}
+	return fmt.Sprintf("cartridge: unknown cartridge type %#02x", e.Type)
+}
+
+// ChecksumError is returned when the header or global checksum doesn't match.
+// Real hardware refuses to boot only on a bad header checksum.
+type ChecksumError struct {
+	Kind string // "header" or "global"
+	Want uint16
+	Got  uint16
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("cartridge: bad %s checksum: %#04x, want %#04x", e.Kind, e.Got, e.Want)
+}
+
+// Errors is returned when the header has more than one problem.
+// errors.As finds any of them
+type Errors []error
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// As lets errors.As look into each error
+func (e Errors) As(target interface{}) bool {
+	for _, err := range e {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// err returns nil for no errors and the error itself for a single one
+func (e Errors) err() error {
+	switch len(e) {
+	case 0:
+		return nil
+	case 1:
+		return e[0]
+	}
+	return e
+}
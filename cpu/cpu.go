@@ -18,7 +18,7 @@ func printWord(opcode uint16) {
 
 type CPU struct {
 	mmu        *mmu.MMU
-	ticks      uint8
+	ticks      uint16
 	TotalTicks uint32
 
 	// registers
@@ -37,6 +37,13 @@ type CPU struct {
 	halt         bool
 	stop         bool
 	isIntEnabled bool
+
+	// EI enables interrupts after the next instruction
+	eiPending bool
+
+	// HALT with interrupts disabled and an interrupt pending doesn't halt,
+	// and the next byte is read twice because PC fails to increment
+	haltBug bool
 }
 
 // New return CPU
@@ -56,11 +63,11 @@ func (cpu *CPU) Reset() {
 
 	cpu.pc = 0x100
 
-	cpu.setReg16("AF", 0x01b0)
-	cpu.setReg16("BC", 0x0013)
-	cpu.setReg16("DE", 0x00d8)
-	cpu.setReg16("HL", 0x014d)
-	cpu.setReg16("SP", 0xfffe)
+	cpu.setReg16(regAF, 0x01b0)
+	cpu.setReg16(regBC, 0x0013)
+	cpu.setReg16(regDE, 0x00d8)
+	cpu.setReg16(regHL, 0x014d)
+	cpu.setReg16(regSP, 0xfffe)
 	cpu.mmu.Write(0xff05, 0x00)
 	cpu.mmu.Write(0xff06, 0x00)
 	cpu.mmu.Write(0xff07, 0x00)
@@ -97,11 +104,11 @@ func (cpu *CPU) Reset() {
 
 func (cpu *CPU) SetCGBMode() {
 	// for CGB
-	cpu.setReg16("AF", 0x1180)
-	cpu.setReg16("BC", 0x0000)
-	cpu.setReg16("DE", 0xff56)
-	cpu.setReg16("HL", 0x000d)
-	cpu.setReg16("SP", 0xfffe)
+	cpu.setReg16(regAF, 0x1180)
+	cpu.setReg16(regBC, 0x0000)
+	cpu.setReg16(regDE, 0xff56)
+	cpu.setReg16(regHL, 0x000d)
+	cpu.setReg16(regSP, 0xfffe)
 }
 
 func (cpu *CPU) SetPC(addr uint16) {
@@ -168,9 +175,33 @@ func (cpu *CPU) PrintNextIns() {
 	fmt.Printf("Next instruction: %#02x\n", cpu.mmu.Read(cpu.pc))
 }
 
+// tick runs the rest of the system for a machine cycle (4 ticks).
+// Instructions call it for each memory access and internal delay
+// so that the PPU and timer are up to date in the middle of an instruction.
+func (cpu *CPU) tick() {
+	cpu.ticks += 4
+	cpu.TotalTicks += uint32(cpu.mmu.Tick(4))
+}
+
+// read reads memory in a machine cycle
+func (cpu *CPU) read(addr uint16) uint8 {
+	cpu.tick()
+	return cpu.mmu.Read(addr)
+}
+
+// write writes memory in a machine cycle
+func (cpu *CPU) write(addr uint16, val uint8) {
+	cpu.tick()
+	cpu.mmu.Write(addr, val)
+}
+
 func (cpu *CPU) Fetch() uint8 {
-	res := cpu.mmu.Read(cpu.pc)
-	cpu.pc++
+	res := cpu.read(cpu.pc)
+	if cpu.haltBug {
+		cpu.haltBug = false
+	} else {
+		cpu.pc++
+	}
 
 	// after reaching 0x100, disable BIOS
 	if cpu.pc >= 0x100 {
@@ -188,57 +219,73 @@ func (cpu *CPU) FetchWord() uint16 {
 	return uint16(high)<<8 | uint16(low)
 }
 
-func (cpu *CPU) HandleInterrupts() {
+// pendingInterrupts returns the interrupts that are both requested and enabled
+func (cpu *CPU) pendingInterrupts() uint8 {
+	return cpu.mmu.Read(0xff0f) & cpu.mmu.Read(0xffff) & 0x1f
+}
+
+// HandleInterrupts services the pending interrupt with the highest priority
+// and returns the ticks it took
+func (cpu *CPU) HandleInterrupts() uint16 {
+	cpu.ticks = 0
 	cpu.mmu.UpdateIntFlag()
 
-	intFlag := cpu.mmu.Read(0xff0f)
-	intEnabled := cpu.mmu.Read(0xffff)
+	// only a button press wakes the CPU from STOP
+	if cpu.stop || cpu.pendingInterrupts() == 0 {
+		return cpu.ticks
+	}
+
+	// any pending interrupt wakes up the CPU even if interrupts are disabled
+	cpu.halt = false
 
 	if !cpu.isIntEnabled {
-		if cpu.halt && intFlag&intEnabled > 0 {
-			cpu.halt = false
-		}
-		return
+		return cpu.ticks
 	}
 
-	if intFlag == 0 {
-		return
-	}
+	cpu.serviceInterrupt()
+
+	return cpu.ticks
+}
+
+// serviceInterrupt takes 5 machine cycles.
+// 2 wait cycles, pushing PC and setting PC to the interrupt vector.
+// reference: https://gbdev.io/pandocs/Interrupts.html#interrupt-handling
+func (cpu *CPU) serviceInterrupt() {
+	cpu.isIntEnabled = false
+
+	cpu.tick()
+	cpu.tick()
+
+	cpu.sp--
+	cpu.write(cpu.sp, uint8(cpu.pc>>8))
+
+	// the interrupt is chosen after the high byte is pushed.
+	// if the push overwrote IE (SP = 0x0000), the interrupt can be cancelled
+	// and the CPU jumps to 0x0000 instead. mooneye ie_push tests this
+	pending := cpu.pendingInterrupts()
+
+	cpu.sp--
+	cpu.write(cpu.sp, uint8(cpu.pc))
+
+	cpu.pc = 0x0000
 
 	// bit 0: V-Blank
 	// bit 1: LCD
 	// bit 2: Timer
 	// bit 3: Serial
 	// bit 4: Joypad
+	// the lower bit has the higher priority
 	for i := 0; i < 5; i++ {
-		if intFlag&(1<<i) > 0 && intEnabled&(1<<i) > 0 {
-			cpu.serviceInterrupt(i)
+		if pending&(1<<i) > 0 {
+			// reset interrupt flag
+			intFlag := cpu.mmu.Read(0xff0f)
+			intFlag &= ^(uint8(1 << i))
+			cpu.mmu.Write(0xff0f, intFlag)
+
+			cpu.pc = 0x40 + uint16(i)*8
+			break
 		}
 	}
-}
 
-func (cpu *CPU) serviceInterrupt(interrupt int) {
-	cpu.isIntEnabled = false
-	cpu.halt = false
-
-	// reset interrupt flag
-	intFlag := cpu.mmu.Read(0xff0f)
-	intFlag &= ^(uint8(1 << interrupt))
-	cpu.mmu.Write(0xff0f, intFlag)
-
-	// save current pc
-	cpu.pushd16(cpu.pc)
-
-	switch interrupt {
-	case 0:
-		cpu.pc = 0x40
-	case 1:
-		cpu.pc = 0x48
-	case 2:
-		cpu.pc = 0x50
-	case 3:
-		cpu.pc = 0x58
-	case 4:
-		cpu.pc = 0x60
-	}
+	cpu.tick()
 }
@@ -1,635 +1,226 @@
 package cpu
 
-// 0 tick means undefined or conditional calls and returns
-var ticksTable [256]uint8 = [256]uint8{
-	// 0x
-	4, 12, 8, 8, 4, 4, 8, 4,
-	20, 8, 8, 8, 4, 4, 8, 4,
-	// 1x
-	0, 12, 8, 8, 4, 4, 8, 4,
-	12, 8, 8, 8, 4, 4, 8, 4,
-	// 2x
-	0, 12, 8, 8, 4, 4, 8, 4,
-	0, 8, 8, 8, 4, 4, 8, 4,
-	// 3x
-	0, 12, 8, 8, 12, 12, 12, 4,
-	0, 8, 8, 8, 4, 4, 8, 4,
-	// 4x
-	4, 4, 4, 4, 4, 4, 8, 4,
-	4, 4, 4, 4, 4, 4, 8, 4,
-	// 5x
-	4, 4, 4, 4, 4, 4, 8, 4,
-	4, 4, 4, 4, 4, 4, 8, 4,
-	// 6x
-	4, 4, 4, 4, 4, 4, 8, 4,
-	4, 4, 4, 4, 4, 4, 8, 4,
-	// 7x
-	8, 8, 8, 8, 8, 8, 0, 8,
-	4, 4, 4, 4, 4, 4, 8, 4,
-	// 8x
-	4, 4, 4, 4, 4, 4, 8, 4,
-	4, 4, 4, 4, 4, 4, 8, 4,
-	// 9x
-	4, 4, 4, 4, 4, 4, 8, 4,
-	4, 4, 4, 4, 4, 4, 8, 4,
-	// ax
-	4, 4, 4, 4, 4, 4, 8, 4,
-	4, 4, 4, 4, 4, 4, 8, 4,
-	// bx
-	4, 4, 4, 4, 4, 4, 8, 4,
-	4, 4, 4, 4, 4, 4, 8, 4,
-	// cx
-	0, 12, 0, 16, 0, 16, 8, 16,
-	0, 16, 0, 0, 0, 24, 8, 16,
-	// dx
-	0, 12, 0, 0, 0, 16, 8, 16,
-	0, 16, 0, 0, 0, 0, 8, 16,
-	// ex
-	12, 12, 8, 0, 0, 16, 8, 16,
-	16, 4, 16, 0, 0, 0, 8, 16,
-	// fx
-	12, 12, 8, 4, 0, 16, 8, 16,
-	12, 8, 16, 4, 0, 0, 8, 16,
-}
-
-func parseBit(opcode, base uint8) uint8 {
-	// (higher 4-bit - base) * 2 + bit3
-	return (opcode>>4-base)*2 + (opcode >> 3 & 1)
-}
-
-func parseReg(opcode uint8) string {
-	val := opcode & 0xf
-
-	switch val {
-	case 0x7, 0xf:
-		return "A"
-	case 0x0, 0x8:
-		return "B"
-	case 0x1, 0x9:
-		return "C"
-	case 0x2, 0xa:
-		return "D"
-	case 0x3, 0xb:
-		return "E"
-	case 0x4, 0xc:
-		return "H"
-	case 0x5, 0xd:
-		return "L"
-	case 0x6, 0xe:
-		return "(HL)"
-	}
-
-	return "unknown"
-}
-
-func (cpu *CPU) Execute() uint8 {
-	cpu.ticks = 0
-
-	if cpu.halt {
-		// add ticks
-		cpu.ticks += 4
-		cpu.TotalTicks += uint32(cpu.ticks)
-		return cpu.ticks
-	}
+// opcodes and cbOpcodes are the instruction tables indexed by opcode.
+// Operands are decoded once when the tables are built, not on every instruction.
+// nil means undefined
+var opcodes [256]func(cpu *CPU)
+var cbOpcodes [256]func(cpu *CPU)
 
-	opcode := cpu.Fetch()
+// register operands of 16-bit loads and arithmetic, ordered by bit 4-5 of the opcode
+var opcodeReg16s = [4]reg16{regBC, regDE, regHL, regSP}
 
-	switch opcode {
+// register operands of PUSH & POP. AF takes the place of SP
+var stackReg16s = [4]reg16{regBC, regDE, regHL, regAF}
 
+func init() {
 	// Misc
-	case 0x00:
-		cpu.NOP()
-	case 0x76:
-		cpu.HALT()
-	case 0x10:
-		cpu.STOP()
-
-	case 0x27:
-		cpu.DAA()
-
-	case 0x2f:
-		cpu.CPL()
+	opcodes[0x00] = (*CPU).NOP
+	opcodes[0x76] = (*CPU).HALT
+	opcodes[0x10] = (*CPU).STOP
+	opcodes[0x27] = (*CPU).DAA
+	opcodes[0x2f] = (*CPU).CPL
+	opcodes[0x3f] = (*CPU).CCF
+	opcodes[0x37] = (*CPU).SCF
+	opcodes[0xf3] = (*CPU).DI
+	opcodes[0xfb] = (*CPU).EI
 
-	case 0x3f:
-		cpu.CCF()
-	case 0x37:
-		cpu.SCF()
+	// 8-bit loads
+	for i := 0; i < 8; i++ {
+		reg := reg8(i)
+
+		// LD nn, n
+		if reg == memHL {
+			opcodes[0x36] = (*CPU).LDmHLd8
+		} else {
+			opcodes[0x06|i<<3] = func(cpu *CPU) { cpu.LDr8d8(reg) }
+		}
 
-	case 0xf3:
-		cpu.DI()
-	case 0xfb:
-		cpu.EI()
+		// LD r1, r2
+		for j := 0; j < 8; j++ {
+			src := reg8(j)
+			opcode := 0x40 | i<<3 | j
+
+			switch {
+			case reg == memHL && src == memHL:
+				// HALT
+			case reg == memHL:
+				// put value into memory
+				opcodes[opcode] = func(cpu *CPU) { cpu.LDmr16r8(regHL, src) }
+			case src == memHL:
+				// put value at memory into r8
+				opcodes[opcode] = func(cpu *CPU) { cpu.LDr8mr16(reg, regHL) }
+			default:
+				opcodes[opcode] = func(cpu *CPU) { cpu.LDr8r8(reg, src) }
+			}
+		}
+	}
 
-	// 8-bit loads
-	// LD nn, n
-	case 0x06:
-		cpu.LDr8d8("B")
-	case 0x0e:
-		cpu.LDr8d8("C")
-	case 0x16:
-		cpu.LDr8d8("D")
-	case 0x1e:
-		cpu.LDr8d8("E")
-	case 0x26:
-		cpu.LDr8d8("H")
-	case 0x2e:
-		cpu.LDr8d8("L")
-	case 0x3e:
-		cpu.LDr8d8("A")
-
-	// LD r1, r2
-	case 0x78:
-		cpu.LDr8r8("A", "B")
-	case 0x79:
-		cpu.LDr8r8("A", "C")
-	case 0x7a:
-		cpu.LDr8r8("A", "D")
-	case 0x7b:
-		cpu.LDr8r8("A", "E")
-	case 0x7c:
-		cpu.LDr8r8("A", "H")
-	case 0x7d:
-		cpu.LDr8r8("A", "L")
-	case 0x7f:
-		cpu.LDr8r8("A", "A")
-	case 0x40:
-		cpu.LDr8r8("B", "B")
-	case 0x41:
-		cpu.LDr8r8("B", "C")
-	case 0x42:
-		cpu.LDr8r8("B", "D")
-	case 0x43:
-		cpu.LDr8r8("B", "E")
-	case 0x44:
-		cpu.LDr8r8("B", "H")
-	case 0x45:
-		cpu.LDr8r8("B", "L")
-	case 0x47:
-		cpu.LDr8r8("B", "A")
-	case 0x48:
-		cpu.LDr8r8("C", "B")
-	case 0x49:
-		cpu.LDr8r8("C", "C")
-	case 0x4a:
-		cpu.LDr8r8("C", "D")
-	case 0x4b:
-		cpu.LDr8r8("C", "E")
-	case 0x4c:
-		cpu.LDr8r8("C", "H")
-	case 0x4d:
-		cpu.LDr8r8("C", "L")
-	case 0x4f:
-		cpu.LDr8r8("C", "A")
-	case 0x50:
-		cpu.LDr8r8("D", "B")
-	case 0x51:
-		cpu.LDr8r8("D", "C")
-	case 0x52:
-		cpu.LDr8r8("D", "D")
-	case 0x53:
-		cpu.LDr8r8("D", "E")
-	case 0x54:
-		cpu.LDr8r8("D", "H")
-	case 0x55:
-		cpu.LDr8r8("D", "L")
-	case 0x57:
-		cpu.LDr8r8("D", "A")
-	case 0x58:
-		cpu.LDr8r8("E", "B")
-	case 0x59:
-		cpu.LDr8r8("E", "C")
-	case 0x5a:
-		cpu.LDr8r8("E", "D")
-	case 0x5b:
-		cpu.LDr8r8("E", "E")
-	case 0x5c:
-		cpu.LDr8r8("E", "H")
-	case 0x5d:
-		cpu.LDr8r8("E", "L")
-	case 0x5f:
-		cpu.LDr8r8("E", "A")
-	case 0x60:
-		cpu.LDr8r8("H", "B")
-	case 0x61:
-		cpu.LDr8r8("H", "C")
-	case 0x62:
-		cpu.LDr8r8("H", "D")
-	case 0x63:
-		cpu.LDr8r8("H", "E")
-	case 0x64:
-		cpu.LDr8r8("H", "H")
-	case 0x65:
-		cpu.LDr8r8("H", "L")
-	case 0x67:
-		cpu.LDr8r8("H", "A")
-	case 0x68:
-		cpu.LDr8r8("L", "B")
-	case 0x69:
-		cpu.LDr8r8("L", "C")
-	case 0x6a:
-		cpu.LDr8r8("L", "D")
-	case 0x6b:
-		cpu.LDr8r8("L", "E")
-	case 0x6c:
-		cpu.LDr8r8("L", "H")
-	case 0x6d:
-		cpu.LDr8r8("L", "L")
-	case 0x6f:
-		cpu.LDr8r8("L", "A")
-
-	// Put value at memory into r8
-	case 0x0a:
-		cpu.LDr8mr16("A", "BC")
-	case 0x1a:
-		cpu.LDr8mr16("A", "DE")
-	case 0x7e:
-		cpu.LDr8mr16("A", "HL")
-	case 0x46:
-		cpu.LDr8mr16("B", "HL")
-	case 0x4e:
-		cpu.LDr8mr16("C", "HL")
-	case 0x56:
-		cpu.LDr8mr16("D", "HL")
-	case 0x5e:
-		cpu.LDr8mr16("E", "HL")
-	case 0x66:
-		cpu.LDr8mr16("H", "HL")
-	case 0x6e:
-		cpu.LDr8mr16("L", "HL")
-
-	case 0x2a:
-		cpu.LDIAmHL()
-	case 0x3a:
-		cpu.LDDAmHL()
-
-	case 0xf0:
-		cpu.LDHAmd8()
-	case 0xf2:
-		cpu.LDAmC()
-	case 0xfa:
-		cpu.LDAmd16()
-
-	// Put value into memory
-	case 0x02:
-		cpu.LDmr16r8("BC", "A")
-	case 0x12:
-		cpu.LDmr16r8("DE", "A")
-	case 0x70:
-		cpu.LDmr16r8("HL", "B")
-	case 0x71:
-		cpu.LDmr16r8("HL", "C")
-	case 0x72:
-		cpu.LDmr16r8("HL", "D")
-	case 0x73:
-		cpu.LDmr16r8("HL", "E")
-	case 0x74:
-		cpu.LDmr16r8("HL", "H")
-	case 0x75:
-		cpu.LDmr16r8("HL", "L")
-	case 0x77:
-		cpu.LDmr16r8("HL", "A")
-
-	case 0x22:
-		cpu.LDImHLA()
-	case 0x32:
-		cpu.LDDmHLA()
-
-	case 0x36:
-		cpu.LDmHLd8()
-	case 0xe0:
-		cpu.LDHmd8A()
-	case 0xe2:
-		cpu.LDmCA()
-	case 0xea:
-		cpu.LDmd16A()
+	opcodes[0x0a] = func(cpu *CPU) { cpu.LDr8mr16(regA, regBC) }
+	opcodes[0x1a] = func(cpu *CPU) { cpu.LDr8mr16(regA, regDE) }
+	opcodes[0x2a] = (*CPU).LDIAmHL
+	opcodes[0x3a] = (*CPU).LDDAmHL
+	opcodes[0xf0] = (*CPU).LDHAmd8
+	opcodes[0xf2] = (*CPU).LDAmC
+	opcodes[0xfa] = (*CPU).LDAmd16
+
+	opcodes[0x02] = func(cpu *CPU) { cpu.LDmr16r8(regBC, regA) }
+	opcodes[0x12] = func(cpu *CPU) { cpu.LDmr16r8(regDE, regA) }
+	opcodes[0x22] = (*CPU).LDImHLA
+	opcodes[0x32] = (*CPU).LDDmHLA
+	opcodes[0xe0] = (*CPU).LDHmd8A
+	opcodes[0xe2] = (*CPU).LDmCA
+	opcodes[0xea] = (*CPU).LDmd16A
 
 	// 16-bit loads
-	case 0x01:
-		cpu.LDr16d16("BC")
-	case 0x11:
-		cpu.LDr16d16("DE")
-	case 0x21:
-		cpu.LDr16d16("HL")
-	case 0x31:
-		cpu.LDr16d16("SP")
-	case 0x08:
-		cpu.LDmd16SP()
-	case 0xf8:
-		cpu.LDHLSPs8()
-	case 0xf9:
-		cpu.LDr16r16("SP", "HL")
-	case 0xf5:
-		cpu.PUSHr16("AF")
-	case 0xc5:
-		cpu.PUSHr16("BC")
-	case 0xd5:
-		cpu.PUSHr16("DE")
-	case 0xe5:
-		cpu.PUSHr16("HL")
-	case 0xf1:
-		cpu.POPr16("AF")
-	case 0xc1:
-		cpu.POPr16("BC")
-	case 0xd1:
-		cpu.POPr16("DE")
-	case 0xe1:
-		cpu.POPr16("HL")
+	for i := 0; i < 4; i++ {
+		reg := opcodeReg16s[i]
+		stackReg := stackReg16s[i]
+
+		opcodes[0x01|i<<4] = func(cpu *CPU) { cpu.LDr16d16(reg) }
+		opcodes[0xc5|i<<4] = func(cpu *CPU) { cpu.PUSHr16(stackReg) }
+		opcodes[0xc1|i<<4] = func(cpu *CPU) { cpu.POPr16(stackReg) }
+	}
+	opcodes[0x08] = (*CPU).LDmd16SP
+	opcodes[0xf8] = (*CPU).LDHLSPs8
+	opcodes[0xf9] = func(cpu *CPU) { cpu.LDr16r16(regSP, regHL) }
 
 	// 8-bit ALU
 	// Rotate & Shifts
-	case 0x07:
-		cpu.RLCA()
-	case 0x17:
-		cpu.RLA()
-	case 0x0f:
-		cpu.RRCA()
-	case 0x1f:
-		cpu.RRA()
-
-	// ADD n
-	case 0x80, 0x81, 0x82, 0x83, 0x84, 0x85, 0x86, 0x87:
-		reg := parseReg(opcode)
-		cpu.ADDr8(reg)
-	case 0xc6:
-		cpu.ADDr8("#")
-
-	// ADC n
-	case 0x88, 0x89, 0x8a, 0x8b, 0x8c, 0x8d, 0x8e, 0x8f:
-		reg := parseReg(opcode)
-		cpu.ADCr8(reg)
-	case 0xce:
-		cpu.ADCr8("#")
-
-	// SUB n
-	case 0x90, 0x91, 0x92, 0x93, 0x94, 0x95, 0x96, 0x97:
-		reg := parseReg(opcode)
-		cpu.SUBr8(reg)
-	case 0xd6:
-		cpu.SUBr8("#")
-
-	// SBC n
-	case 0x98, 0x99, 0x9a, 0x9b, 0x9c, 0x9d, 0x9e, 0x9f:
-		reg := parseReg(opcode)
-		cpu.SBCr8(reg)
-	case 0xde:
-		cpu.SBCr8("#")
-
-	// AND n
-	case 0xa0, 0xa1, 0xa2, 0xa3, 0xa4, 0xa5, 0xa6, 0xa7:
-		reg := parseReg(opcode)
-		cpu.ANDr8(reg)
-	case 0xe6:
-		cpu.ANDr8("#")
-
-	// OR n
-	case 0xb0, 0xb1, 0xb2, 0xb3, 0xb4, 0xb5, 0xb6, 0xb7:
-		reg := parseReg(opcode)
-		cpu.ORr8(reg)
-	case 0xf6:
-		cpu.ORr8("#")
-
-	// XOR n
-	case 0xa8, 0xa9, 0xaa, 0xab, 0xac, 0xad, 0xae, 0xaf:
-		reg := parseReg(opcode)
-		cpu.XORr8(reg)
-	case 0xee:
-		cpu.XORr8("#")
-
-	// INC n
-	case 0x3c:
-		cpu.INCr8("A")
-	case 0x04:
-		cpu.INCr8("B")
-	case 0x0c:
-		cpu.INCr8("C")
-	case 0x14:
-		cpu.INCr8("D")
-	case 0x1c:
-		cpu.INCr8("E")
-	case 0x24:
-		cpu.INCr8("H")
-	case 0x2c:
-		cpu.INCr8("L")
-	case 0x34:
-		cpu.INCmHL()
-
-	// DEC n
-	case 0x3d:
-		cpu.DECr8("A")
-	case 0x05:
-		cpu.DECr8("B")
-	case 0x0d:
-		cpu.DECr8("C")
-	case 0x15:
-		cpu.DECr8("D")
-	case 0x1d:
-		cpu.DECr8("E")
-	case 0x25:
-		cpu.DECr8("H")
-	case 0x2d:
-		cpu.DECr8("L")
-	case 0x35:
-		cpu.DECmHL()
-
-	// CP n
-	case 0xb8, 0xb9, 0xba, 0xbb, 0xbc, 0xbd, 0xbe, 0xbf:
-		reg := parseReg(opcode)
-		cpu.CPr8(reg)
-	case 0xfe:
-		cpu.CPr8("#")
+	opcodes[0x07] = (*CPU).RLCA
+	opcodes[0x17] = (*CPU).RLA
+	opcodes[0x0f] = (*CPU).RRCA
+	opcodes[0x1f] = (*CPU).RRA
+
+	// ADD, ADC, SUB, SBC, AND, XOR, OR, CP ordered by bit 3-5 of the opcode
+	alu := [8]func(cpu *CPU, reg reg8){
+		(*CPU).ADDr8, (*CPU).ADCr8, (*CPU).SUBr8, (*CPU).SBCr8,
+		(*CPU).ANDr8, (*CPU).XORr8, (*CPU).ORr8, (*CPU).CPr8,
+	}
+	for i, op := range alu {
+		op := op
+		for j := 0; j < 8; j++ {
+			reg := reg8(j)
+			opcodes[0x80|i<<3|j] = func(cpu *CPU) { op(cpu, reg) }
+		}
+		// immediate value
+		opcodes[0xc6|i<<3] = func(cpu *CPU) { op(cpu, imm) }
+	}
+
+	// INC n & DEC n
+	for i := 0; i < 8; i++ {
+		reg := reg8(i)
+		if reg == memHL {
+			opcodes[0x34] = (*CPU).INCmHL
+			opcodes[0x35] = (*CPU).DECmHL
+			continue
+		}
+		opcodes[0x04|i<<3] = func(cpu *CPU) { cpu.INCr8(reg) }
+		opcodes[0x05|i<<3] = func(cpu *CPU) { cpu.DECr8(reg) }
+	}
 
 	// 16-bit ALU
-	// ADD nn
-	case 0x09:
-		cpu.ADDHLr16("BC")
-	case 0x19:
-		cpu.ADDHLr16("DE")
-	case 0x29:
-		cpu.ADDHLr16("HL")
-	case 0x39:
-		cpu.ADDHLr16("SP")
-
-	// ADD SP, n
-	case 0xe8:
-		cpu.ADDSPsd8()
-
-	// INC nn
-	case 0x03:
-		cpu.INCr16("BC")
-	case 0x13:
-		cpu.INCr16("DE")
-	case 0x23:
-		cpu.INCr16("HL")
-	case 0x33:
-		cpu.INCr16("SP")
-	// DEC nn
-	case 0x0B:
-		cpu.DECr16("BC")
-	case 0x1B:
-		cpu.DECr16("DE")
-	case 0x2B:
-		cpu.DECr16("HL")
-	case 0x3B:
-		cpu.DECr16("SP")
-
-	///////////
-	// Jumps
-	// JP nn
-	case 0xc3:
-		cpu.JPd16()
-
-	// JP cc, nn
-	case 0xc2:
-		cpu.JPccd16("NZ")
-	case 0xca:
-		cpu.JPccd16("Z")
-	case 0xd2:
-		cpu.JPccd16("NC")
-	case 0xda:
-		cpu.JPccd16("C")
-
-	// JP (HL)
-	case 0xe9:
-		cpu.JPHL()
-
-	// JR n
-	case 0x18:
-		cpu.JRsd8()
-
-	// JR cc, n
-	case 0x20:
-		cpu.JRccs8("NZ")
-	case 0x28:
-		cpu.JRccs8("Z")
-	case 0x30:
-		cpu.JRccs8("NC")
-	case 0x38:
-		cpu.JRccs8("C")
-
-	///////////
-	// Calls
-	case 0xcd:
-		cpu.CALLd16()
-
-	case 0xc4:
-		cpu.CALLccd16("NZ")
-	case 0xcc:
-		cpu.CALLccd16("Z")
-	case 0xd4:
-		cpu.CALLccd16("NC")
-	case 0xdc:
-		cpu.CALLccd16("C")
-
-	///////////
+	for i := 0; i < 4; i++ {
+		reg := opcodeReg16s[i]
+
+		opcodes[0x09|i<<4] = func(cpu *CPU) { cpu.ADDHLr16(reg) }
+		opcodes[0x03|i<<4] = func(cpu *CPU) { cpu.INCr16(reg) }
+		opcodes[0x0b|i<<4] = func(cpu *CPU) { cpu.DECr16(reg) }
+	}
+	opcodes[0xe8] = (*CPU).ADDSPsd8
+
+	// Jumps, Calls & Returns
+	opcodes[0xc3] = (*CPU).JPd16
+	opcodes[0xe9] = (*CPU).JPHL
+	opcodes[0x18] = (*CPU).JRsd8
+	opcodes[0xcd] = (*CPU).CALLd16
+	opcodes[0xc9] = (*CPU).RET
+	opcodes[0xd9] = (*CPU).RETI
+
+	// NZ, Z, NC, C ordered by bit 3-4 of the opcode
+	for i := 0; i < 4; i++ {
+		cc := cond(i)
+
+		opcodes[0xc2|i<<3] = func(cpu *CPU) { cpu.JPccd16(cc) }
+		opcodes[0x20|i<<3] = func(cpu *CPU) { cpu.JRccs8(cc) }
+		opcodes[0xc4|i<<3] = func(cpu *CPU) { cpu.CALLccd16(cc) }
+		opcodes[0xc0|i<<3] = func(cpu *CPU) { cpu.RETcc(cc) }
+	}
+
 	// Restarts
-	case 0xc7:
-		cpu.RSTd16(0x00)
-	case 0xcf:
-		cpu.RSTd16(0x08)
-	case 0xd7:
-		cpu.RSTd16(0x10)
-	case 0xdf:
-		cpu.RSTd16(0x18)
-	case 0xe7:
-		cpu.RSTd16(0x20)
-	case 0xef:
-		cpu.RSTd16(0x28)
-	case 0xf7:
-		cpu.RSTd16(0x30)
-	case 0xff:
-		cpu.RSTd16(0x38)
-
-	///////////
-	// Returns
-	case 0xc9:
-		cpu.RET()
-	case 0xd9:
-		cpu.RETI()
-
-	// RET cc
-	case 0xc0:
-		cpu.RETcc("NZ")
-	case 0xc8:
-		cpu.RETcc("Z")
-	case 0xd0:
-		cpu.RETcc("NC")
-	case 0xd8:
-		cpu.RETcc("C")
+	for i := 0; i < 8; i++ {
+		addr := uint16(i << 3)
+		opcodes[0xc7|i<<3] = func(cpu *CPU) { cpu.RSTd16(addr) }
+	}
 
 	// CB-prefixed
-	case 0xcb:
-		cpu.mmu.CallTimer(4)
+	opcodes[0xcb] = func(cpu *CPU) {
 		logger.Log("CB-prefixed\n")
 		cpu.CBPrefixed()
-
-	default:
-		logger.Log("unknown opcode: %#02x\n", opcode)
 	}
 
-	// add ticks
-	if (0x34 <= opcode && opcode <= 0x36) || opcode == 0xe0 || opcode == 0xea || opcode == 0xf0 || opcode == 0xfa {
-		cpu.ticks = 0
-		cpu.TotalTicks += uint32(ticksTable[opcode])
-	} else if opcode == 0xcb {
-		cpu.ticks += ticksTable[opcode]
-		cpu.TotalTicks += uint32(cpu.ticks)
-	} else {
-		cpu.ticks += ticksTable[opcode]
-		cpu.TotalTicks += uint32(cpu.ticks)
+	// RLC, RRC, RL, RR, SLA, SRA, SWAP, SRL ordered by bit 3-5 of the opcode
+	shifts := [8]func(cpu *CPU, reg reg8){
+		(*CPU).RLCr8, (*CPU).RRCr8, (*CPU).RLr8, (*CPU).RRr8,
+		(*CPU).SLAr8, (*CPU).SRAr8, (*CPU).SWAPr8, (*CPU).SRLr8,
+	}
+	for i, op := range shifts {
+		op := op
+		for j := 0; j < 8; j++ {
+			reg := reg8(j)
+			cbOpcodes[i<<3|j] = func(cpu *CPU) { op(cpu, reg) }
+		}
 	}
 
-	return cpu.ticks
+	// BIT, RES, SET with the bit number in bit 3-5 of the opcode
+	for b := uint8(0); b < 8; b++ {
+		b := b
+		for j := 0; j < 8; j++ {
+			reg := reg8(j)
+			cbOpcodes[0x40|int(b)<<3|j] = func(cpu *CPU) { cpu.BITbr8(b, reg) }
+			cbOpcodes[0x80|int(b)<<3|j] = func(cpu *CPU) { cpu.RESbr8(b, reg) }
+			cbOpcodes[0xc0|int(b)<<3|j] = func(cpu *CPU) { cpu.SETbr8(b, reg) }
+		}
+	}
 }
 
-func (cpu *CPU) CBPrefixed() {
-	opcode := cpu.Fetch()
+func (cpu *CPU) Execute() uint16 {
+	cpu.ticks = 0
 
-	reg := parseReg(opcode)
+	if cpu.halt {
+		cpu.tick()
+		return cpu.ticks
+	}
 
-	if reg == "(HL)" {
-		if 0x40 <= opcode && opcode <= 0x7f {
-			cpu.ticks += 8
+	if cpu.stop {
+		// the clock is stopped until a button is pressed.
+		// time still passes for the frame
+		if !cpu.mmu.ButtonPressed() {
+			cpu.ticks += 4
+			cpu.TotalTicks += 4
+			return cpu.ticks
 		}
-	} else {
-		cpu.ticks += 4
+		cpu.stop = false
+	}
+
+	// interrupts enabled by EI in the previous instruction can be serviced after this one
+	if cpu.eiPending {
+		cpu.eiPending = false
+		cpu.isIntEnabled = true
 	}
 
-	switch {
-	// RLC
-	case 0x00 <= opcode && opcode <= 0x07:
-		cpu.RLCr8(reg)
-	// RL
-	case 0x10 <= opcode && opcode <= 0x17:
-		cpu.RLr8(reg)
-	// RRC
-	case 0x08 <= opcode && opcode <= 0x0f:
-		cpu.RRCr8(reg)
-	// RR
-	case 0x18 <= opcode && opcode <= 0x1f:
-		cpu.RRr8(reg)
-	// SLA
-	case 0x20 <= opcode && opcode <= 0x27:
-		cpu.SLAr8(reg)
-	// SRA
-	case 0x28 <= opcode && opcode <= 0x2f:
-		cpu.SRAr8(reg)
-	// SWAP
-	case 0x30 <= opcode && opcode <= 0x37:
-		cpu.SWAPr8(reg)
-	// SRL
-	case 0x38 <= opcode && opcode <= 0x3f:
-		cpu.SRLr8(reg)
-	// BIT
-	case 0x40 <= opcode && opcode <= 0x7f:
-		b := parseBit(opcode, 0x4)
-		cpu.BITbr8(b, reg)
-	// RES
-	case 0x80 <= opcode && opcode <= 0xbf:
-		b := parseBit(opcode, 0x8)
-		cpu.RESbr8(b, reg)
-	// SET
-	case 0xc0 <= opcode && opcode <= 0xff:
-		b := parseBit(opcode, 0xc)
-		cpu.SETbr8(b, reg)
+	opcode := cpu.Fetch()
+
+	if instruction := opcodes[opcode]; instruction != nil {
+		instruction(cpu)
+	} else {
+		logger.Log("unknown opcode: %#02x\n", opcode)
 	}
+
+	return cpu.ticks
+}
+
+func (cpu *CPU) CBPrefixed() {
+	opcode := cpu.Fetch()
+
+	cbOpcodes[opcode](cpu)
 }
@@ -0,0 +1,74 @@
+package cpu
+
+import (
+	"gbemu/apu"
+	"gbemu/gpu"
+	"gbemu/joypad"
+	"gbemu/mmu"
+	"gbemu/timer"
+	"testing"
+)
+
+// benchProgram is a loop of mixed register, ALU, memory, stack and CB instructions at 0x100
+var benchProgram = []byte{
+	0x21, 0x00, 0xc0, // LD HL,0xc000
+	0x78, 0x81, 0x47, 0x3c, 0x0c, 0xa8, 0xb1, 0xfe, 0x10, // LD A,B; ADD C; LD B,A; INC A; INC C; XOR B; OR C; CP 0x10
+	0x77, 0x23, 0x7e, 0x2b, 0xcb, 0x37, 0xcb, 0x7c, // LD (HL),A; INC HL; LD A,(HL); DEC HL; SWAP A; BIT 7,H
+	0xc5, 0xd1, 0x13, 0x1b, 0x09, 0x57, 0x5f, // PUSH BC; POP DE; INC DE; DEC DE; ADD HL,BC; LD D,A; LD E,A
+	0x21, 0x00, 0xc0, 0x18, 0xe3, // LD HL,0xc000; JR back to LD A,B at 0x103
+}
+
+func newBenchCPU(tb testing.TB) *CPU {
+	rom := make([]byte, 0x8000)
+	copy(rom[0x100:], benchProgram)
+
+	// fix up the checksums so that loading doesn't warn
+	var x uint8
+	for i := 0x134; i <= 0x14c; i++ {
+		x = x - rom[i] - 1
+	}
+	rom[0x14d] = x
+	var sum uint16
+	for _, val := range rom {
+		sum += uint16(val)
+	}
+	rom[0x14e], rom[0x14f] = uint8(sum>>8), uint8(sum)
+
+	mmu := mmu.New(gpu.New(), timer.New(), joypad.New(), apu.New())
+	if err := mmu.Load(rom, "", ""); err != nil {
+		tb.Fatal(err)
+	}
+
+	cpu := New(mmu)
+	cpu.Reset()
+	return cpu
+}
+
+// the loop of benchProgram starts after LD HL at 0x100
+const benchLoopStart = 0x103
+
+func TestBenchProgramLoops(t *testing.T) {
+	cpu := newBenchCPU(t)
+
+	// 24 instructions through the program and the JR at the end
+	for i := 0; i < 24; i++ {
+		cpu.Execute()
+	}
+	if pc := cpu.GetPC(); pc != benchLoopStart {
+		t.Errorf("pc = %#04x after one pass, want %#04x", pc, benchLoopStart)
+	}
+}
+
+// BenchmarkExecute runs one instruction of benchProgram per iteration,
+// with the rest of the machine ticking as the CPU accesses memory
+func BenchmarkExecute(b *testing.B) {
+	cpu := newBenchCPU(b)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cpu.Execute()
+		cpu.HandleInterrupts()
+	}
+
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds()/1e6, "Minstr/s")
+}
@@ -8,14 +8,14 @@ package cpu
 // m*  means data in memory address *
 // b   means bit
 
-func (cpu *CPU) getd8(src string) uint8 {
+func (cpu *CPU) getd8(src reg8) uint8 {
 	var n uint8
 
 	switch src {
-	case "#":
+	case imm:
 		n = cpu.Fetch()
-	case "(HL)":
-		n = cpu.mmu.Read(cpu.getReg16("HL"))
+	case memHL:
+		n = cpu.read(cpu.getReg16(regHL))
 	default:
 		n = cpu.getReg8(src)
 	}
@@ -23,13 +23,13 @@ func (cpu *CPU) getd8(src string) uint8 {
 	return n
 }
 
-func (cpu *CPU) setd8(dst string, val uint8) {
+func (cpu *CPU) setd8(dst reg8, val uint8) {
 
 	switch dst {
-	case "#":
+	case imm:
 		logger.Log("cannot set value to immediate value\n")
-	case "(HL)":
-		cpu.mmu.Write(cpu.getReg16("HL"), val)
+	case memHL:
+		cpu.write(cpu.getReg16(regHL), val)
 	default:
 		cpu.setReg8(dst, val)
 	}
@@ -41,7 +41,7 @@ func signExtend(a uint8) uint16 {
 
 // param: Z, N, H, C
 func (cpu *CPU) getFlag(f uint8) uint8 {
-	return cpu.getReg8("F") >> f & 1
+	return cpu.getReg8(regF) >> f & 1
 }
 
 func checkHalfCarry(a, b, c uint8) uint8 {
@@ -98,7 +98,7 @@ func (cpu *CPU) NOP() {
 //======================================================================
 
 // LDr8d8 put value d8 into r8
-func (cpu *CPU) LDr8d8(reg string) {
+func (cpu *CPU) LDr8d8(reg reg8) {
 	n := cpu.Fetch()
 	logger.Log("LD %s, %#02x\n", reg, n)
 
@@ -108,17 +108,15 @@ func (cpu *CPU) LDr8d8(reg string) {
 // LDmHLd8 put value d8 into address HL
 func (cpu *CPU) LDmHLd8() {
 	n := cpu.Fetch()
-	cpu.mmu.CallTimer(4)
-	addr := cpu.getReg16("HL")
+	addr := cpu.getReg16(regHL)
 
-	cpu.mmu.Write(addr, n)
-	cpu.mmu.CallTimer(8)
+	cpu.write(addr, n)
 
 	logger.Log("LD (HL), %#02x\n", n)
 }
 
 // LDr8r8 put value reg2 into reg1
-func (cpu *CPU) LDr8r8(reg1, reg2 string) {
+func (cpu *CPU) LDr8r8(reg1, reg2 reg8) {
 	logger.Log("LD %s, %s\n", reg1, reg2)
 
 	val := cpu.getReg8(reg2)
@@ -127,10 +125,10 @@ func (cpu *CPU) LDr8r8(reg1, reg2 string) {
 }
 
 // LDr8mr16 put value at address r16 into r8
-func (cpu *CPU) LDr8mr16(reg1, reg2 string) {
+func (cpu *CPU) LDr8mr16(reg1 reg8, reg2 reg16) {
 	addr := cpu.getReg16(reg2)
 
-	val := cpu.mmu.Read(addr)
+	val := cpu.read(addr)
 
 	cpu.setReg8(reg1, val)
 
@@ -138,23 +136,21 @@ func (cpu *CPU) LDr8mr16(reg1, reg2 string) {
 }
 
 // LDmr16r8 put value into address r16
-func (cpu *CPU) LDmr16r8(reg1, reg2 string) {
+func (cpu *CPU) LDmr16r8(reg1 reg16, reg2 reg8) {
 	logger.Log("LD (%s), %s\n", reg1, reg2)
 
 	addr := cpu.getReg16(reg1)
 
 	val := cpu.getReg8(reg2)
 
-	cpu.mmu.Write(addr, val)
+	cpu.write(addr, val)
 }
 
 // LDmd16A put value A into address d16
 func (cpu *CPU) LDmd16A() {
 	addr := cpu.FetchWord()
-	cpu.mmu.CallTimer(8)
 
-	cpu.mmu.Write(addr, cpu.getReg8("A"))
-	cpu.mmu.CallTimer(8)
+	cpu.write(addr, cpu.getReg8(regA))
 
 	logger.Log("LD (%#02x), A\n", addr)
 }
@@ -162,34 +158,32 @@ func (cpu *CPU) LDmd16A() {
 // LDAmd16 put value at address d16 into A
 func (cpu *CPU) LDAmd16() {
 	addr := cpu.FetchWord()
-	cpu.mmu.CallTimer(8)
 
-	val := cpu.mmu.Read(addr)
+	val := cpu.read(addr)
 
-	cpu.setReg8("A", val)
-	cpu.mmu.CallTimer(8)
+	cpu.setReg8(regA, val)
 
 	logger.Log("LD A, (%#02x)\n", addr)
 }
 
 // LDmCA put A into address 0xff00 + register C
 func (cpu *CPU) LDmCA() {
-	val := cpu.getReg8("A")
+	val := cpu.getReg8(regA)
 
-	addr := 0xff00 + uint16(cpu.getReg8("C"))
+	addr := 0xff00 + uint16(cpu.getReg8(regC))
 
-	cpu.mmu.Write(addr, val)
+	cpu.write(addr, val)
 
 	logger.Log("LD (C), A\n")
 }
 
 // LDAmC put value at address 0xff00 + register C into A
 func (cpu *CPU) LDAmC() {
-	addr := 0xff00 + uint16(cpu.getReg8("C"))
+	addr := 0xff00 + uint16(cpu.getReg8(regC))
 
-	val := cpu.mmu.Read(addr)
+	val := cpu.read(addr)
 
-	cpu.setReg8("A", val)
+	cpu.setReg8(regA, val)
 
 	logger.Log("LD A, (C)\n")
 }
@@ -197,12 +191,10 @@ func (cpu *CPU) LDAmC() {
 // LDHAmd8 put value at address 0xff00 + d8 into A
 func (cpu *CPU) LDHAmd8() {
 	addr := 0xff00 + uint16(cpu.Fetch())
-	cpu.mmu.CallTimer(4)
 
-	val := cpu.mmu.Read(addr)
+	val := cpu.read(addr)
 
-	cpu.setReg8("A", val)
-	cpu.mmu.CallTimer(8)
+	cpu.setReg8(regA, val)
 
 	logger.Log("LD A, (%#02x)\n", addr)
 }
@@ -210,10 +202,8 @@ func (cpu *CPU) LDHAmd8() {
 // LDHmd8A put value A into address 0xff00 + d8
 func (cpu *CPU) LDHmd8A() {
 	addr := 0xff00 + uint16(cpu.Fetch())
-	cpu.mmu.CallTimer(4)
 
-	cpu.mmu.Write(addr, cpu.getReg8("A"))
-	cpu.mmu.CallTimer(8)
+	cpu.write(addr, cpu.getReg8(regA))
 
 	logger.Log("LD (%#02x), A\n", addr)
 }
@@ -222,43 +212,43 @@ func (cpu *CPU) LDHmd8A() {
 func (cpu *CPU) LDImHLA() {
 	logger.Log("LDI (HL), A\n")
 
-	cpu.LDmr16r8("HL", "A")
+	cpu.LDmr16r8(regHL, regA)
 
-	cpu.INCr16("HL")
+	cpu.setReg16(regHL, cpu.getReg16(regHL)+1)
 }
 
 // LDIAmHL put value at address HL into A. Increment HL
 func (cpu *CPU) LDIAmHL() {
 	logger.Log("LDI A, (HL)\n")
 
-	cpu.LDr8mr16("A", "HL")
+	cpu.LDr8mr16(regA, regHL)
 
-	cpu.INCr16("HL")
+	cpu.setReg16(regHL, cpu.getReg16(regHL)+1)
 }
 
 // LDDmHLA put A into memory address HL. Decrement HL
 func (cpu *CPU) LDDmHLA() {
 	logger.Log("LDD (HL), A\n")
 
-	cpu.LDmr16r8("HL", "A")
+	cpu.LDmr16r8(regHL, regA)
 
-	cpu.DECr16("HL")
+	cpu.setReg16(regHL, cpu.getReg16(regHL)-1)
 }
 
 // LDDAmHL put value at address HL into A. Decrement HL
 func (cpu *CPU) LDDAmHL() {
 	logger.Log("LDD A, (HL)\n")
 
-	cpu.LDr8mr16("A", "HL")
+	cpu.LDr8mr16(regA, regHL)
 
-	cpu.DECr16("HL")
+	cpu.setReg16(regHL, cpu.getReg16(regHL)-1)
 }
 
 ////////////////////////
 // 16-bit
 
 // LDr16d16 put value d16 into r16
-func (cpu *CPU) LDr16d16(reg string) {
+func (cpu *CPU) LDr16d16(reg reg16) {
 	nn := cpu.FetchWord()
 
 	cpu.setReg16(reg, nn)
@@ -270,16 +260,18 @@ func (cpu *CPU) LDr16d16(reg string) {
 func (cpu *CPU) LDmd16SP() {
 	addr := cpu.FetchWord()
 
-	sp := cpu.getReg16("SP")
+	sp := cpu.getReg16(regSP)
 
-	cpu.mmu.WriteWord(addr, sp)
+	cpu.write(addr, uint8(sp))
+	cpu.write(addr+1, uint8(sp>>8))
 
 	logger.Log("LD (%#04x), SP\n", addr)
 }
 
 // LDr16r16 put reg2 into reg1
-func (cpu *CPU) LDr16r16(reg1, reg2 string) {
+func (cpu *CPU) LDr16r16(reg1, reg2 reg16) {
 	cpu.setReg16(reg1, cpu.getReg16(reg2))
+	cpu.tick()
 
 	logger.Log("LD %s, %s\n", reg1, reg2)
 }
@@ -288,35 +280,28 @@ func (cpu *CPU) LDr16r16(reg1, reg2 string) {
 func (cpu *CPU) LDHLSPs8() {
 	n := cpu.Fetch()
 
-	sp := cpu.getReg16("SP")
+	sp := cpu.getReg16(regSP)
 
 	c := checkCarry(uint8(n), uint8(sp&0xff), 0)
 	h := checkHalfCarry(uint8(n), uint8(sp&0xff), 0)
 	cpu.setFlags(RESET, RESET, h, c)
 
-	cpu.setReg16("HL", sp+signExtend(n))
+	cpu.setReg16(regHL, sp+signExtend(n))
+	cpu.tick()
 
 	logger.Log("LDHL SP, %#02x\n", n)
 }
 
 // PUSHr16 decrement SP twice and push register r16 onto stack.
-func (cpu *CPU) PUSHr16(reg string) {
-	addr := cpu.getReg16("SP") - 2
-	cpu.setReg16("SP", addr)
-
-	cpu.mmu.WriteWord(addr, cpu.getReg16(reg))
+func (cpu *CPU) PUSHr16(reg reg16) {
+	cpu.pushd16(cpu.getReg16(reg))
 
 	logger.Log("PUSH %s\n", reg)
 }
 
 // POPr16 pop two bytes off stack into register r16. Increment SP twice
-func (cpu *CPU) POPr16(reg string) {
-	addr := cpu.getReg16("SP")
-	val := cpu.mmu.ReadWord(addr)
-
-	cpu.setReg16("SP", addr+2)
-
-	cpu.setReg16(reg, val)
+func (cpu *CPU) POPr16(reg reg16) {
+	cpu.setReg16(reg, cpu.popd16())
 
 	logger.Log("POP %s\n", reg)
 }
@@ -325,22 +310,22 @@ func (cpu *CPU) POPr16(reg string) {
 // Jumps
 //======================================================================
 
-func (cpu *CPU) checkCurrentCondition(cc string) bool {
+func (cpu *CPU) checkCurrentCondition(cc cond) bool {
 	switch cc {
-	case "NZ":
-		if testBit(Z, cpu.getReg8("F")) {
+	case condNZ:
+		if testBit(Z, cpu.getReg8(regF)) {
 			return false
 		}
-	case "Z":
-		if !testBit(Z, cpu.getReg8("F")) {
+	case condZ:
+		if !testBit(Z, cpu.getReg8(regF)) {
 			return false
 		}
-	case "NC":
-		if testBit(C, cpu.getReg8("F")) {
+	case condNC:
+		if testBit(C, cpu.getReg8(regF)) {
 			return false
 		}
-	case "C":
-		if !testBit(C, cpu.getReg8("F")) {
+	case condC:
+		if !testBit(C, cpu.getReg8(regF)) {
 			return false
 		}
 	}
@@ -351,57 +336,60 @@ func (cpu *CPU) checkCurrentCondition(cc string) bool {
 // JPd16 jump to address d16
 func (cpu *CPU) JPd16() {
 	cpu.pc = cpu.FetchWord()
+	cpu.tick()
 }
 
 // JPHL jump to address contained in HL
 func (cpu *CPU) JPHL() {
-	cpu.pc = cpu.getReg16("HL")
+	cpu.pc = cpu.getReg16(regHL)
 }
 
 // JRsd8 add sd8 to current address and jump to it
 func (cpu *CPU) JRsd8() {
 	cpu.pc += signExtend(cpu.Fetch())
+	cpu.tick()
 }
 
 // JRccs8 if current condition is true, add n to current address and jump to it
-func (cpu *CPU) JRccs8(cc string) {
+func (cpu *CPU) JRccs8(cc cond) {
 	n := cpu.Fetch()
 
 	logger.Log("JR %s, %#04x\n", cc, n)
 
 	if !cpu.checkCurrentCondition(cc) {
-		cpu.ticks += 8
 		return
 	}
 
 	cpu.pc = cpu.pc + signExtend(n)
-	cpu.ticks += 12
+	cpu.tick()
 }
 
 // JPccd16 if current condition is true, jump to address d16
-func (cpu *CPU) JPccd16(cc string) {
+func (cpu *CPU) JPccd16(cc cond) {
 	nn := cpu.FetchWord()
 
 	logger.Log("JP %s, %#04x\n", cc, nn)
 
 	if !cpu.checkCurrentCondition(cc) {
-		cpu.ticks += 12
 		return
 	}
 
 	cpu.pc = nn
-	cpu.ticks += 16
+	cpu.tick()
 }
 
 //======================================================================
 // Calls
 //======================================================================
 
+// pushd16 takes 3 machine cycles. SP is decremented first, then the high byte is written
 func (cpu *CPU) pushd16(d uint16) {
-	addr := cpu.getReg16("SP") - 2
-	cpu.setReg16("SP", addr)
+	cpu.tick()
 
-	cpu.mmu.WriteWord(addr, d)
+	cpu.sp--
+	cpu.write(cpu.sp, uint8(d>>8))
+	cpu.sp--
+	cpu.write(cpu.sp, uint8(d))
 }
 
 // CALLd16 push address of next instruction onto stack
@@ -417,13 +405,12 @@ func (cpu *CPU) CALLd16() {
 }
 
 // CALLccd16 call address d16 if current condition is true
-func (cpu *CPU) CALLccd16(cc string) {
+func (cpu *CPU) CALLccd16(cc cond) {
 	logger.Log("CALL %s\n", cc)
 
 	jumpTo := cpu.FetchWord()
 
 	if !cpu.checkCurrentCondition(cc) {
-		cpu.ticks += 12
 		return
 	}
 
@@ -432,8 +419,6 @@ func (cpu *CPU) CALLccd16(cc string) {
 	cpu.pushd16(cpu.pc)
 
 	cpu.pc = jumpTo
-
-	cpu.ticks += 24
 }
 
 //======================================================================
@@ -441,15 +426,18 @@ func (cpu *CPU) CALLccd16(cc string) {
 //======================================================================
 
 func (cpu *CPU) popd16() uint16 {
-	addr := cpu.getReg16("SP")
-	cpu.setReg16("SP", addr+2)
+	low := cpu.read(cpu.sp)
+	cpu.sp++
+	high := cpu.read(cpu.sp)
+	cpu.sp++
 
-	return cpu.mmu.ReadWord(addr)
+	return uint16(high)<<8 | uint16(low)
 }
 
 // RET pop two bytes from stack & jump to that address
 func (cpu *CPU) RET() {
 	cpu.pc = cpu.popd16()
+	cpu.tick()
 
 	logger.Log("RET %#04x\n", cpu.pc)
 }
@@ -457,26 +445,27 @@ func (cpu *CPU) RET() {
 // RETI return and enable interrupts
 func (cpu *CPU) RETI() {
 	cpu.pc = cpu.popd16()
+	cpu.tick()
 
 	logger.Log("RETI %#04x\n", cpu.pc)
 	logger.Log("Enable interrupts\n")
 
-	cpu.EI()
+	// unlike EI, RETI enables interrupts immediately
+	cpu.isIntEnabled = true
 }
 
 // RETcc return if current condition is true
-func (cpu *CPU) RETcc(cc string) {
+func (cpu *CPU) RETcc(cc cond) {
 	logger.Log("RETcc %s\n", cc)
 
+	// checking the condition takes a cycle
+	cpu.tick()
 	if !cpu.checkCurrentCondition(cc) {
-		cpu.ticks += 8
 		return
 	}
 
 	logger.Log("cc is true\n")
 	cpu.RET()
-
-	cpu.ticks += 20
 }
 
 //======================================================================
@@ -500,24 +489,24 @@ func (cpu *CPU) RSTd16(nn uint16) {
 // 8-bit
 
 // ADDr8 add r8 to A
-func (cpu *CPU) ADDr8(reg string) {
+func (cpu *CPU) ADDr8(reg reg8) {
 	n := cpu.getd8(reg)
-	a := cpu.getReg8("A")
+	a := cpu.getReg8(regA)
 
 	z := checkZero(a + n)
 	h := checkHalfCarry(a, n, 0)
 	c := checkCarry(a, n, 0)
 	cpu.setFlags(z, RESET, h, c)
 
-	cpu.setReg8("A", a+n)
+	cpu.setReg8(regA, a+n)
 
 	logger.Log("ADD %s(=%#02x)\n", reg, n)
 }
 
 // ADCr8 add r8 + carry flag to A
-func (cpu *CPU) ADCr8(reg string) {
+func (cpu *CPU) ADCr8(reg reg8) {
 	n := cpu.getd8(reg)
-	a := cpu.getReg8("A")
+	a := cpu.getReg8(regA)
 	oldCarry := cpu.getFlag(C)
 
 	z := checkZero((n + a + oldCarry))
@@ -525,30 +514,30 @@ func (cpu *CPU) ADCr8(reg string) {
 	c := checkCarry(a, n, oldCarry)
 	cpu.setFlags(z, RESET, h, c)
 
-	cpu.setReg8("A", a+n+oldCarry)
+	cpu.setReg8(regA, a+n+oldCarry)
 
 	logger.Log("ADC %s(n=%#02x)\n", reg, n)
 }
 
 // SUBr8 subtract r8 from A
-func (cpu *CPU) SUBr8(reg string) {
+func (cpu *CPU) SUBr8(reg reg8) {
 	n := cpu.getd8(reg)
-	a := cpu.getReg8("A")
+	a := cpu.getReg8(regA)
 
 	z := checkZero(a - n)
 	h := checkHalfBorrow(a, n, 0)
 	c := checkBorrow(a, n, 0)
 	cpu.setFlags(z, SET, h, c)
 
-	cpu.setReg8("A", a-n)
+	cpu.setReg8(regA, a-n)
 
 	logger.Log("SUB %s(=%#02x)\n", reg, n)
 }
 
 // SBCr8 subtract r8 + carry flag from A
-func (cpu *CPU) SBCr8(reg string) {
+func (cpu *CPU) SBCr8(reg reg8) {
 	n := cpu.getd8(reg)
-	a := cpu.getReg8("A")
+	a := cpu.getReg8(regA)
 	oldCarry := cpu.getFlag(C)
 
 	z := checkZero(a - n - oldCarry)
@@ -556,55 +545,55 @@ func (cpu *CPU) SBCr8(reg string) {
 	c := checkBorrow(a, n, oldCarry)
 	cpu.setFlags(z, SET, h, c)
 
-	cpu.setReg8("A", a-n-oldCarry)
+	cpu.setReg8(regA, a-n-oldCarry)
 
 	logger.Log("SUB %s(=%#02x)\n", reg, n)
 }
 
 // ANDr8 logically AND r8 with A, result in A
-func (cpu *CPU) ANDr8(reg string) {
+func (cpu *CPU) ANDr8(reg reg8) {
 	n := cpu.getd8(reg)
 
-	res := cpu.getReg8("A") & n
+	res := cpu.getReg8(regA) & n
 
 	z := checkZero(res)
 	cpu.setFlags(z, RESET, SET, RESET)
 
-	cpu.setReg8("A", res)
+	cpu.setReg8(regA, res)
 
 	logger.Log("AND %s(=%#02x)\n", reg, n)
 }
 
 // ORr8 logically OR r8 with register A, result in A
-func (cpu *CPU) ORr8(reg string) {
+func (cpu *CPU) ORr8(reg reg8) {
 	n := cpu.getd8(reg)
 
-	res := cpu.getReg8("A") | n
+	res := cpu.getReg8(regA) | n
 
 	z := checkZero(res)
 	cpu.setFlags(z, RESET, RESET, RESET)
 
-	cpu.setReg8("A", res)
+	cpu.setReg8(regA, res)
 
 	logger.Log("OR %s(=%#02x)\n", reg, n)
 }
 
 // XORr8 exclusive OR n with register A, result in A
-func (cpu *CPU) XORr8(reg string) {
+func (cpu *CPU) XORr8(reg reg8) {
 	n := cpu.getd8(reg)
 
-	res := cpu.getReg8("A") ^ n
+	res := cpu.getReg8(regA) ^ n
 
 	z := checkZero(res)
 	cpu.setFlags(z, RESET, RESET, RESET)
 
-	cpu.setReg8("A", res)
+	cpu.setReg8(regA, res)
 
 	logger.Log("XOR %s(=%#02x)\n", reg, n)
 }
 
 // INCr8 increment r8
-func (cpu *CPU) INCr8(reg string) {
+func (cpu *CPU) INCr8(reg reg8) {
 	n := cpu.getd8(reg)
 
 	z := checkZero(n + 1)
@@ -617,36 +606,32 @@ func (cpu *CPU) INCr8(reg string) {
 }
 
 func (cpu *CPU) INCmHL() {
-	n := cpu.getd8("(HL)")
-	cpu.mmu.CallTimer(4)
+	n := cpu.getd8(memHL)
 
 	z := checkZero(n + 1)
 	h := checkHalfCarry(n, 1, 0)
 	cpu.setFlags(z, RESET, h, NA)
 
-	cpu.setd8("(HL)", n+1)
-	cpu.mmu.CallTimer(8)
+	cpu.setd8(memHL, n+1)
 
-	logger.Log("INC %s\n", "(HL)")
+	logger.Log("INC (HL)\n")
 }
 
 // DECr8 decrement r8
 func (cpu *CPU) DECmHL() {
-	n := cpu.getd8("(HL)")
-	cpu.mmu.CallTimer(4)
+	n := cpu.getd8(memHL)
 
 	z := checkZero(n - 1)
 	h := checkHalfBorrow(n, 1, 0)
 	cpu.setFlags(z, SET, h, NA)
 
-	cpu.setd8("(HL)", n-1)
-	cpu.mmu.CallTimer(8)
+	cpu.setd8(memHL, n-1)
 
-	logger.Log("DEC %s\n", "(HL)")
+	logger.Log("DEC (HL)\n")
 }
 
 // DECr8 decrement r8
-func (cpu *CPU) DECr8(reg string) {
+func (cpu *CPU) DECr8(reg reg8) {
 	n := cpu.getd8(reg)
 
 	z := checkZero(n - 1)
@@ -661,9 +646,9 @@ func (cpu *CPU) DECr8(reg string) {
 // CPr8 compare A with r8.
 // This is basically an A - n subtraction instruction.
 // but the result is thrown away
-func (cpu *CPU) CPr8(reg string) {
+func (cpu *CPU) CPr8(reg reg8) {
 	n := cpu.getd8(reg)
-	a := cpu.getReg8("A")
+	a := cpu.getReg8(regA)
 
 	z := checkZero(a - n)
 	h := checkHalfBorrow(a, n, 0)
@@ -680,18 +665,18 @@ func (cpu *CPU) CPr8(reg string) {
 // 16-bit
 
 // func (cpu *CPU) TestFlags() {
-// 	cpu.setReg16("HL", 0xffff)
-// 	// cpu.setReg16("BC", 0x1000) // expect 0b0001
-// 	// cpu.setReg16("BC", 0x0100) // expect 0b0011
-// 	cpu.setReg16("BC", 0x0010) // expect 0b0011
-// 	cpu.ADDHLr16("BC")
-// 	fmt.Printf("%#08b\n", cpu.getReg8("F"))
+// 	cpu.setReg16(regHL, 0xffff)
+// 	// cpu.setReg16(regBC, 0x1000) // expect 0b0001
+// 	// cpu.setReg16(regBC, 0x0100) // expect 0b0011
+// 	cpu.setReg16(regBC, 0x0010) // expect 0b0011
+// 	cpu.ADDHLr16(regBC)
+// 	fmt.Printf("%#08b\n", cpu.getReg8(regF))
 // }
 
 // ADDHLr16 add r16 to HL
-func (cpu *CPU) ADDHLr16(reg string) {
+func (cpu *CPU) ADDHLr16(reg reg16) {
 	nn := cpu.getReg16(reg)
-	hl := cpu.getReg16("HL")
+	hl := cpu.getReg16(regHL)
 
 	// calculate lower byte first
 	lc := checkCarry(uint8(nn&0xff), uint8(hl&0xff), 0)
@@ -702,7 +687,8 @@ func (cpu *CPU) ADDHLr16(reg string) {
 
 	cpu.setFlags(NA, RESET, h, c)
 
-	cpu.setReg16("HL", hl+nn)
+	cpu.setReg16(regHL, hl+nn)
+	cpu.tick()
 
 	logger.Log("ADD HL, %s\n", reg)
 }
@@ -710,7 +696,7 @@ func (cpu *CPU) ADDHLr16(reg string) {
 // ADDSPsd8 add sd8 to stack pointer sp
 func (cpu *CPU) ADDSPsd8() {
 	n := cpu.Fetch()
-	sp := cpu.getReg16("SP")
+	sp := cpu.getReg16(regSP)
 
 	var spl uint8 = uint8(sp & 0xff)
 	h := checkHalfCarry(n, spl, 0)
@@ -718,21 +704,25 @@ func (cpu *CPU) ADDSPsd8() {
 
 	cpu.setFlags(RESET, RESET, h, c)
 
-	cpu.setReg16("SP", sp+signExtend(n))
+	cpu.setReg16(regSP, sp+signExtend(n))
+	cpu.tick()
+	cpu.tick()
 
 	logger.Log("s")
 }
 
 // INCr16 increment r16
-func (cpu *CPU) INCr16(reg string) {
+func (cpu *CPU) INCr16(reg reg16) {
 	cpu.setReg16(reg, cpu.getReg16(reg)+1)
+	cpu.tick()
 
 	logger.Log("INC %s\n", reg)
 }
 
 // DECr16 decrement r16
-func (cpu *CPU) DECr16(reg string) {
+func (cpu *CPU) DECr16(reg reg16) {
 	cpu.setReg16(reg, cpu.getReg16(reg)-1)
+	cpu.tick()
 
 	logger.Log("DEC %s\n", reg)
 }
@@ -743,28 +733,28 @@ func (cpu *CPU) DECr16(reg string) {
 
 // RLCA rotate A left, reset zero flag
 func (cpu *CPU) RLCA() {
-	cpu.RLCr8("A")
+	cpu.RLCr8(regA)
 	cpu.setFlags(RESET, RESET, RESET, NA)
 	logger.Log("RLCA\n")
 }
 
 // RLA rotate A, reset zero flag
 func (cpu *CPU) RLA() {
-	cpu.RLr8("A")
+	cpu.RLr8(regA)
 	cpu.setFlags(RESET, RESET, RESET, NA)
 	logger.Log("RLA\n")
 }
 
 // RRCA rotate A right. old bit 0 to carry flag. reset zero flag
 func (cpu *CPU) RRCA() {
-	cpu.RRCr8("A")
+	cpu.RRCr8(regA)
 	cpu.setFlags(RESET, RESET, RESET, NA)
 	logger.Log("RRCA\n")
 }
 
 // RRA rotte A right through carry flag. reset zero flag
 func (cpu *CPU) RRA() {
-	cpu.RRr8("A")
+	cpu.RRr8(regA)
 	cpu.setFlags(RESET, RESET, RESET, NA)
 	logger.Log("RRCA\n")
 }
@@ -775,7 +765,7 @@ func (cpu *CPU) RRA() {
 
 // DAA decimal adjust register A for Binary Coded Decimal
 func (cpu *CPU) DAA() {
-	a := uint16(cpu.getReg8("A"))
+	a := uint16(cpu.getReg8(regA))
 
 	var c uint8 = NA
 
@@ -810,14 +800,14 @@ func (cpu *CPU) DAA() {
 
 	cpu.setFlags(z, NA, RESET, c)
 
-	cpu.setReg8("A", uint8(a&0xff))
+	cpu.setReg8(regA, uint8(a&0xff))
 
 	logger.Log("DAA\n")
 }
 
 // CPL complement A register
 func (cpu *CPU) CPL() {
-	cpu.setReg8("A", ^cpu.getReg8("A"))
+	cpu.setReg8(regA, ^cpu.getReg8(regA))
 
 	cpu.setFlags(NA, SET, SET, NA)
 
@@ -844,42 +834,57 @@ func (cpu *CPU) SCF() {
 
 // HALT power down CPU until an interrupt occurs
 func (cpu *CPU) HALT() {
-	// TODO: research HALT
-	cpu.halt = true
+	if !cpu.isIntEnabled && cpu.pendingInterrupts() > 0 {
+		// HALT bug. the CPU continues without halting
+		// reference: https://gbdev.io/pandocs/halt.html#halt-bug
+		cpu.haltBug = true
+	} else {
+		cpu.halt = true
+	}
 
 	logger.Log("HALT\n")
 }
 
-// STOP halt CPU & LCD display until button pressed
+// machine cycles the CPU pauses for during a speed switch
+const speedSwitchCycles = 2050
+
+// STOP switches the speed on CGB if KEY1 is prepared.
+// Otherwise it halts CPU & LCD display until button pressed.
+// reference: https://gbdev.io/pandocs/Reducing_Power_Consumption.html#using-the-stop-instruction
 func (cpu *CPU) STOP() {
-	// TODO: research STOP
-	cpu.stop = true
+	// STOP is followed by a padding byte
+	cpu.Fetch()
 
-	key1 := cpu.mmu.Read(0xff4d)
-	if key1&1 > 0 {
-		if key1>>7 > 0 {
-			key1 = 0
-			// normal speed mode
-		} else {
-			key1 = 0x80
-			// double speed mode
+	if cpu.mmu.SpeedSwitchArmed() {
+		cpu.mmu.SwitchSpeed()
+
+		// the CPU pauses while the clock settles. the rest of the system keeps running
+		// reference: https://gbdev.io/pandocs/CGB_Registers.html#ff4d--key1-cgb-mode-only-prepare-speed-switch
+		for i := 0; i < speedSwitchCycles; i++ {
+			cpu.tick()
 		}
-		cpu.mmu.Write(0xff4d, key1)
+
+		logger.Log("STOP (speed switch)\n")
+		return
 	}
 
+	cpu.stop = true
+	cpu.mmu.EnterStopMode()
+
 	logger.Log("STOP\n")
 }
 
 // DI disable interrupts
 func (cpu *CPU) DI() {
 	cpu.isIntEnabled = false
+	cpu.eiPending = false
 
 	logger.Log("DI\n")
 }
 
-// EI enable interrupts
+// EI enable interrupts after the next instruction
 func (cpu *CPU) EI() {
-	cpu.isIntEnabled = true
+	cpu.eiPending = true
 
 	logger.Log("EI\n")
 }
@@ -889,7 +894,7 @@ func (cpu *CPU) EI() {
 //======================================================================
 
 // BITbr8 test bit b in register r8
-func (cpu *CPU) BITbr8(b uint8, reg string) {
+func (cpu *CPU) BITbr8(b uint8, reg reg8) {
 	val := cpu.getd8(reg)
 
 	if testBit(b, val) {
@@ -902,40 +907,24 @@ func (cpu *CPU) BITbr8(b uint8, reg string) {
 }
 
 // SETbr8 set bit b in register r8
-func (cpu *CPU) SETbr8(b uint8, reg string) {
+func (cpu *CPU) SETbr8(b uint8, reg reg8) {
 	val := cpu.getd8(reg) | 1<<b
-	if reg == "(HL)" {
-		cpu.mmu.CallTimer(4)
-	}
 	cpu.setd8(reg, val)
 
-	if reg == "(HL)" {
-		cpu.mmu.CallTimer(8)
-	}
 	logger.Log("SET %s\n", reg)
 }
 
 // RESbr8 reset bit b in register r8
-func (cpu *CPU) RESbr8(b uint8, reg string) {
+func (cpu *CPU) RESbr8(b uint8, reg reg8) {
 	val := cpu.getd8(reg) &^ (1 << b)
-	if reg == "(HL)" {
-		cpu.mmu.CallTimer(4)
-	}
 	cpu.setd8(reg, val)
 
-	if reg == "(HL)" {
-		cpu.mmu.CallTimer(8)
-	}
-
 	logger.Log("RES %s\n", reg)
 }
 
 // SWAPr8 swap upper & lower nibles of r8
-func (cpu *CPU) SWAPr8(reg string) {
+func (cpu *CPU) SWAPr8(reg reg8) {
 	val := cpu.getd8(reg)
-	if reg == "(HL)" {
-		cpu.mmu.CallTimer(4)
-	}
 
 	res := val>>4 | val&0x0f<<4
 
@@ -944,19 +933,13 @@ func (cpu *CPU) SWAPr8(reg string) {
 	cpu.setFlags(z, RESET, RESET, RESET)
 
 	cpu.setd8(reg, res)
-	if reg == "(HL)" {
-		cpu.mmu.CallTimer(8)
-	}
 
 	logger.Log("SWAP %s\n", reg)
 }
 
 // RLCr8 rotate r8 left. old bit 7 to carry flag
-func (cpu *CPU) RLCr8(reg string) {
+func (cpu *CPU) RLCr8(reg reg8) {
 	val := cpu.getd8(reg)
-	if reg == "(HL)" {
-		cpu.mmu.CallTimer(4)
-	}
 
 	res := val<<1 | val>>7&1
 
@@ -970,19 +953,13 @@ func (cpu *CPU) RLCr8(reg string) {
 	cpu.setFlags(z, RESET, RESET, c)
 
 	cpu.setd8(reg, res)
-	if reg == "(HL)" {
-		cpu.mmu.CallTimer(8)
-	}
 
 	logger.Log("RLC %s\n", reg)
 }
 
 // RLr8 rotate r8 left through carry flag
-func (cpu *CPU) RLr8(reg string) {
+func (cpu *CPU) RLr8(reg reg8) {
 	val := cpu.getd8(reg)
-	if reg == "(HL)" {
-		cpu.mmu.CallTimer(4)
-	}
 
 	res := val<<1 | cpu.getFlag(C)
 
@@ -997,19 +974,12 @@ func (cpu *CPU) RLr8(reg string) {
 
 	cpu.setd8(reg, res)
 
-	if reg == "(HL)" {
-		cpu.mmu.CallTimer(8)
-	}
-
 	logger.Log("RL %s\n", reg)
 }
 
 // RRCr8 rotate r8 right. old bit 0 to carry flag
-func (cpu *CPU) RRCr8(reg string) {
+func (cpu *CPU) RRCr8(reg reg8) {
 	val := cpu.getd8(reg)
-	if reg == "(HL)" {
-		cpu.mmu.CallTimer(4)
-	}
 
 	res := val>>1 | (val&1)<<7
 
@@ -1023,19 +993,13 @@ func (cpu *CPU) RRCr8(reg string) {
 	cpu.setFlags(z, RESET, RESET, c)
 
 	cpu.setd8(reg, res)
-	if reg == "(HL)" {
-		cpu.mmu.CallTimer(8)
-	}
 
 	logger.Log("RR %s\n", reg)
 }
 
 // RRr8 rotate r8 right through carry flag
-func (cpu *CPU) RRr8(reg string) {
+func (cpu *CPU) RRr8(reg reg8) {
 	val := cpu.getd8(reg)
-	if reg == "(HL)" {
-		cpu.mmu.CallTimer(4)
-	}
 
 	res := val>>1 | cpu.getFlag(C)<<7
 
@@ -1049,19 +1013,13 @@ func (cpu *CPU) RRr8(reg string) {
 	cpu.setFlags(z, RESET, RESET, c)
 
 	cpu.setd8(reg, res)
-	if reg == "(HL)" {
-		cpu.mmu.CallTimer(8)
-	}
 
 	logger.Log("RR %s\n", reg)
 }
 
 // SLAr8 shift r8 left into carry. LSB of r8 set to 0
-func (cpu *CPU) SLAr8(reg string) {
+func (cpu *CPU) SLAr8(reg reg8) {
 	val := cpu.getd8(reg)
-	if reg == "(HL)" {
-		cpu.mmu.CallTimer(4)
-	}
 
 	res := val << 1
 
@@ -1075,19 +1033,13 @@ func (cpu *CPU) SLAr8(reg string) {
 	cpu.setFlags(z, RESET, RESET, c)
 
 	cpu.setd8(reg, res)
-	if reg == "(HL)" {
-		cpu.mmu.CallTimer(8)
-	}
 
 	logger.Log("SLA %s\n", reg)
 }
 
 // SRAr8 shift r8 right into carry. MSB doesn't change.
-func (cpu *CPU) SRAr8(reg string) {
+func (cpu *CPU) SRAr8(reg reg8) {
 	val := cpu.getd8(reg)
-	if reg == "(HL)" {
-		cpu.mmu.CallTimer(4)
-	}
 
 	res := val>>1 | val&0x80
 
@@ -1101,19 +1053,13 @@ func (cpu *CPU) SRAr8(reg string) {
 	cpu.setFlags(z, RESET, RESET, c)
 
 	cpu.setd8(reg, res)
-	if reg == "(HL)" {
-		cpu.mmu.CallTimer(8)
-	}
 
 	logger.Log("SRA %s\n", reg)
 }
 
 // SRLr8 shift r8 right into carry. MSB set to 0
-func (cpu *CPU) SRLr8(reg string) {
+func (cpu *CPU) SRLr8(reg reg8) {
 	val := cpu.getd8(reg)
-	if reg == "(HL)" {
-		cpu.mmu.CallTimer(4)
-	}
 
 	res := (val >> 1) & 0x7f
 
@@ -1127,9 +1073,6 @@ func (cpu *CPU) SRLr8(reg string) {
 	cpu.setFlags(z, RESET, RESET, c)
 
 	cpu.setd8(reg, res)
-	if reg == "(HL)" {
-		cpu.mmu.CallTimer(8)
-	}
 
 	logger.Log("SRA %s\n", reg)
 }
@@ -14,35 +14,77 @@ const (
 	NA    = 2
 )
 
+// reg8 is an 8-bit operand. The first 8 follow the order in the opcode encoding.
+// memHL is the value at address HL and imm is the immediate value after the opcode
+type reg8 uint8
+
+const (
+	regB reg8 = iota
+	regC
+	regD
+	regE
+	regH
+	regL
+	memHL
+	regA
+	regF
+	imm
+)
+
+var reg8Names = [...]string{"B", "C", "D", "E", "H", "L", "(HL)", "A", "F", "#"}
+
+func (reg reg8) String() string {
+	return reg8Names[reg]
+}
+
+// reg16 is a 16-bit register operand
+type reg16 uint8
+
+const (
+	regBC reg16 = iota
+	regDE
+	regHL
+	regSP
+	regAF
+)
+
+var reg16Names = [...]string{"BC", "DE", "HL", "SP", "AF"}
+
+func (reg reg16) String() string {
+	return reg16Names[reg]
+}
+
+// cond is a condition of jumps, calls and returns. The order follows the opcode encoding
+type cond uint8
+
+const (
+	condNZ cond = iota
+	condZ
+	condNC
+	condC
+)
+
+var condNames = [...]string{"NZ", "Z", "NC", "C"}
+
+func (cc cond) String() string {
+	return condNames[cc]
+}
+
 func (cpu *CPU) setFlags(z, n, h, c uint8) {
-	var newFlag uint8 = 0
-	oldFlag := cpu.getReg8("F")
-
-	for b := Z; b >= C; b-- {
-		var status uint8
-
-		switch b {
-		case Z:
-			status = z
-		case N:
-			status = n
-		case H:
-			status = h
-		case C:
-			status = c
-		}
+	newFlag := cpu.f
+
+	for b, status := range [4]uint8{c, h, n, z} {
+		bit := uint8(1) << (C + b)
 
 		switch status {
 		case RESET:
-			newFlag &= ^(1 << b)
+			newFlag &^= bit
 		case SET:
-			newFlag |= 1 << b
-		case NA:
-			newFlag |= oldFlag & (1 << b)
+			newFlag |= bit
 		}
 	}
 
-	cpu.setReg8("F", newFlag)
+	cpu.f = newFlag
 }
 
 // GetPC returns current program counter
@@ -50,80 +92,80 @@ func (cpu *CPU) GetPC() uint16 {
 	return cpu.pc
 }
 
-func (cpu *CPU) getReg8(reg string) byte {
+func (cpu *CPU) getReg8(reg reg8) byte {
 	switch reg {
-	case "A":
+	case regA:
 		return cpu.a
-	case "F":
+	case regF:
 		return cpu.f
-	case "B":
+	case regB:
 		return cpu.b
-	case "C":
+	case regC:
 		return cpu.c
-	case "D":
+	case regD:
 		return cpu.d
-	case "E":
+	case regE:
 		return cpu.e
-	case "H":
+	case regH:
 		return cpu.h
-	case "L":
+	case regL:
 		return cpu.l
 	}
 	return 0
 }
 
-func (cpu *CPU) setReg8(reg string, val byte) {
+func (cpu *CPU) setReg8(reg reg8, val byte) {
 	switch reg {
-	case "A":
+	case regA:
 		cpu.a = val
-	case "F":
+	case regF:
 		cpu.f = val & 0xf0
-	case "B":
+	case regB:
 		cpu.b = val
-	case "C":
+	case regC:
 		cpu.c = val
-	case "D":
+	case regD:
 		cpu.d = val
-	case "E":
+	case regE:
 		cpu.e = val
-	case "H":
+	case regH:
 		cpu.h = val
-	case "L":
+	case regL:
 		cpu.l = val
 	}
 }
 
-func (cpu *CPU) getReg16(reg string) uint16 {
+func (cpu *CPU) getReg16(reg reg16) uint16 {
 	switch reg {
-	case "AF":
+	case regAF:
 		return uint16(cpu.a)<<8 | uint16(cpu.f)
-	case "BC":
+	case regBC:
 		return uint16(cpu.b)<<8 | uint16(cpu.c)
-	case "DE":
+	case regDE:
 		return uint16(cpu.d)<<8 | uint16(cpu.e)
-	case "HL":
+	case regHL:
 		return uint16(cpu.h)<<8 | uint16(cpu.l)
-	case "SP":
+	case regSP:
 		return cpu.sp
 	}
 	return 0
 }
 
-func (cpu *CPU) setReg16(reg string, val uint16) {
+func (cpu *CPU) setReg16(reg reg16, val uint16) {
 	switch reg {
-	case "AF":
+	case regAF:
 		cpu.a = byte(val >> 8 & 0xff)
 		cpu.f = byte(val & 0xf0)
-	case "BC":
+	case regBC:
 		cpu.b = byte(val >> 8 & 0xff)
 		cpu.c = byte(val & 0xff)
-	case "DE":
+	case regDE:
 		cpu.d = byte(val >> 8 & 0xff)
 		cpu.e = byte(val & 0xff)
-	case "HL":
+	case regHL:
 		cpu.h = byte(val >> 8 & 0xff)
 		cpu.l = byte(val & 0xff)
-	case "SP":
+	case regSP:
 		cpu.sp = val
 	}
 }
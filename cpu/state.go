@@ -0,0 +1,25 @@
+package cpu
+
+import (
+	"gbemu/utils"
+	"io"
+)
+
+func (cpu *CPU) stateFields() []interface{} {
+	return []interface{}{
+		&cpu.a, &cpu.f, &cpu.b, &cpu.c, &cpu.d, &cpu.e, &cpu.h, &cpu.l,
+		&cpu.pc, &cpu.sp,
+		&cpu.halt, &cpu.stop, &cpu.isIntEnabled, &cpu.eiPending, &cpu.haltBug,
+		&cpu.TotalTicks,
+	}
+}
+
+// SaveState writes registers and the halt/interrupt state
+func (cpu *CPU) SaveState(w io.Writer) error {
+	return utils.WriteState(w, cpu.stateFields())
+}
+
+// LoadState restores the state written by SaveState
+func (cpu *CPU) LoadState(r io.Reader) error {
+	return utils.ReadState(r, cpu.stateFields())
+}
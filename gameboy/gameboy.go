@@ -0,0 +1,181 @@
+package gameboy
+
+import (
+	"gbemu/apu"
+	"gbemu/camera"
+	"gbemu/cpu"
+	"gbemu/gpu"
+	"gbemu/joypad"
+	"gbemu/mmu"
+	"gbemu/timer"
+)
+
+const (
+	ScreenWidth  = 160
+	ScreenHeight = 144
+
+	// GB CPU is 4194304Hz. To get 60FPS, 4194304/60
+	ticksPerFrame = 69905
+)
+
+// Buttons is a set of pressed buttons
+type Buttons uint8
+
+const (
+	ButtonA Buttons = 1 << iota
+	ButtonB
+	ButtonSelect
+	ButtonStart
+	ButtonRight
+	ButtonLeft
+	ButtonUp
+	ButtonDown
+)
+
+var buttonKeys = map[Buttons]uint8{
+	ButtonA:      joypad.A,
+	ButtonB:      joypad.B,
+	ButtonSelect: joypad.SELECT,
+	ButtonStart:  joypad.START,
+	ButtonRight:  joypad.RIGHT,
+	ButtonLeft:   joypad.LEFT,
+	ButtonUp:     joypad.UP,
+	ButtonDown:   joypad.DOWN,
+}
+
+// Options configures a new Machine
+type Options struct {
+	// SavePath is where battery-backed RAM is stored. Empty means no save file
+	SavePath string
+
+	// Model selects the hardware. ModelAuto decides from the cartridge header
+	Model Model
+
+	// Mapper overrides the mapper detected from the cartridge. see mmu.MapperNames
+	Mapper string
+
+	// Camera feeds the Game Boy Camera. nil means a test pattern
+	Camera camera.Source
+
+	// PixelFIFO renders pixel by pixel so that mid-scanline effects show up. It's slower
+	PixelFIFO bool
+}
+
+// Machine composes all the components of a Game Boy
+type Machine struct {
+	CPU    *cpu.CPU
+	MMU    *mmu.MMU
+	GPU    *gpu.GPU
+	Timer  *timer.Timer
+	Joypad *joypad.Joypad
+	APU    *apu.APU
+
+	model   Model
+	buttons Buttons
+}
+
+// New returns a machine with rom loaded, ready to run from 0x100
+func New(rom []byte, opts Options) (*Machine, error) {
+	machine := &Machine{}
+
+	machine.GPU = gpu.New()
+	machine.Timer = timer.New()
+	machine.Joypad = joypad.New()
+	machine.APU = apu.New()
+	machine.MMU = mmu.New(machine.GPU, machine.Timer, machine.Joypad, machine.APU)
+	machine.CPU = cpu.New(machine.MMU)
+
+	if opts.PixelFIFO {
+		machine.GPU.SetFIFOMode()
+	}
+
+	if err := machine.MMU.Load(rom, opts.SavePath, opts.Mapper); err != nil {
+		return nil, err
+	}
+
+	if opts.Camera != nil {
+		machine.MMU.SetCameraSource(opts.Camera)
+	}
+
+	header := machine.MMU.Header()
+	machine.model = resolveModel(opts.Model, header)
+
+	machine.CPU.Reset()
+	if machine.model == ModelCGB {
+		machine.CPU.SetCGBMode()
+		machine.MMU.SetCGBMode()
+
+		if header.SupportsCGB() {
+			machine.GPU.SetCGBMode()
+		} else {
+			// DMG game on CGB
+			machine.GPU.SetCompatPalettes(compatPalettes(header))
+		}
+	}
+
+	return machine, nil
+}
+
+// Model returns the hardware being emulated. Never ModelAuto
+func (machine *Machine) Model() Model {
+	return machine.model
+}
+
+// StepInstruction executes a single instruction and returns the ticks of the CPU clock it took
+func (machine *Machine) StepInstruction() uint16 {
+	// the CPU runs the other components as it accesses memory
+	ticks := machine.CPU.Execute()
+	ticks += machine.CPU.HandleInterrupts()
+
+	return ticks
+}
+
+// RunFrame runs the machine for the ticks of a single frame
+func (machine *Machine) RunFrame() error {
+	// reset TotalTicks every frame.
+	// TotalTicks counts at the normal speed, so the CPU runs twice the ticks in double speed mode
+	machine.CPU.TotalTicks = 0
+
+	for machine.CPU.TotalTicks < ticksPerFrame {
+		machine.StepInstruction()
+	}
+
+	return machine.MMU.SyncRAM()
+}
+
+// Framebuffer returns the screen as RGBA pixels, ScreenWidth * ScreenHeight * 4 bytes
+func (machine *Machine) Framebuffer() []byte {
+	return machine.GPU.Pixels
+}
+
+// SetButtons presses buttons and releases the rest
+func (machine *Machine) SetButtons(buttons Buttons) {
+	for button, key := range buttonKeys {
+		pressed := buttons&button > 0
+		wasPressed := machine.buttons&button > 0
+
+		if pressed && !wasPressed {
+			machine.Joypad.KeyPress(key)
+		} else if !pressed && wasPressed {
+			machine.Joypad.KeyRelease(key)
+		}
+	}
+
+	machine.buttons = buttons
+}
+
+// SetTilt tilts the Game Boy for cartridges with an accelerometer (MBC7).
+// x and y are in g from -1 to 1. x > 0 is to the right and y > 0 is toward the bottom
+func (machine *Machine) SetTilt(x, y float64) {
+	machine.MMU.SetTilt(x, y)
+}
+
+// SetRumbleHandler sets fn to be called when the rumble motor of the cartridge turns on or off
+func (machine *Machine) SetRumbleHandler(fn func(on bool)) {
+	machine.MMU.SetRumbleHandler(fn)
+}
+
+// Close flushes battery-backed RAM to the save file
+func (machine *Machine) Close() error {
+	return machine.MMU.SaveRAM()
+}
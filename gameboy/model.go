@@ -0,0 +1,52 @@
+package gameboy
+
+import (
+	"fmt"
+	"gbemu/cartridge"
+)
+
+// Model is the hardware to emulate
+type Model uint8
+
+const (
+	// ModelAuto picks CGB for games that support it and DMG for the rest
+	ModelAuto Model = iota
+	ModelDMG
+	ModelCGB
+)
+
+// ParseModel parses "auto", "dmg" or "cgb"
+func ParseModel(s string) (Model, error) {
+	switch s {
+	case "auto", "":
+		return ModelAuto, nil
+	case "dmg":
+		return ModelDMG, nil
+	case "cgb":
+		return ModelCGB, nil
+	}
+	return ModelAuto, fmt.Errorf("gameboy: unknown model %q (want dmg, cgb or auto)", s)
+}
+
+func (model Model) String() string {
+	switch model {
+	case ModelDMG:
+		return "dmg"
+	case ModelCGB:
+		return "cgb"
+	}
+	return "auto"
+}
+
+// resolveModel picks the hardware for the cartridge.
+// CGB flag 0x143: 0x80 = CGB enhanced, 0xc0 = CGB only
+func resolveModel(model Model, header *cartridge.Header) Model {
+	if model != ModelAuto {
+		return model
+	}
+
+	if header.SupportsCGB() {
+		return ModelCGB
+	}
+	return ModelDMG
+}
@@ -0,0 +1,170 @@
+package gameboy
+
+import "gbemu/cartridge"
+
+// The CGB boot ROM colors DMG games. Nintendo titles are looked up by a checksum of the title
+// and get their own palettes. Everything else gets combination 0.
+// The tables are the ones in the boot ROM.
+// reference: https://gbdev.io/pandocs/Power_Up_Sequence.html#compatibility-palettes
+
+// compatTitleChecksums are the title checksums the boot ROM knows.
+// The last 14 are shared by several titles, which are told apart by the 4th letter of the title
+var compatTitleChecksums = [...]uint8{
+	0x00, 0x88, 0x16, 0x36, 0xd1, 0xdb, 0xf2, 0x3c, 0x8c, 0x92, 0x3d, 0x5c, 0x58, 0xc9, 0x3e, 0x70,
+	0x1d, 0x59, 0x69, 0x19, 0x35, 0xa8, 0x14, 0xaa, 0x75, 0x95, 0x99, 0x34, 0x6f, 0x15, 0xff, 0x97,
+	0x4b, 0x90, 0x17, 0x10, 0x39, 0xf7, 0xf6, 0xa2, 0x49, 0x4e, 0x43, 0x68, 0xe0, 0x8b, 0xf0, 0xce,
+	0x0c, 0x29, 0xe8, 0xb7, 0x86, 0x9a, 0x52, 0x01, 0x9d, 0x71, 0x9c, 0xbd, 0x5d, 0x6d, 0x67, 0x3f,
+	0x6b, 0xb3, 0x46, 0x28, 0xa5, 0xc6, 0xd3, 0x27, 0x61, 0x18, 0x66, 0x6a, 0xbf, 0x0d, 0xf4,
+}
+
+// the first index of compatTitleChecksums shared by several titles
+const compatFirstDuplicate = 65
+
+// compatLetters are the 4th letters of the titles sharing a checksum.
+// letter i is for compatTitleChecksums[compatFirstDuplicate+i%14]
+const compatLetters = "BEFAARBEKEK R-URAR INAILICE R"
+
+// compatCombinations are indices of compatCombos by the index of the title.
+// Titles sharing a checksum continue after compatFirstDuplicate by the index in compatLetters
+var compatCombinations = [...]uint8{
+	0, 4, 5, 35, 34, 3, 31, 15, 10, 5, 19, 36, 7, 37, 30, 44,
+	21, 32, 31, 20, 5, 33, 13, 14, 5, 29, 5, 18, 9, 3, 2, 26,
+	25, 25, 41, 42, 26, 45, 42, 45, 36, 38, 26, 42, 30, 41, 34, 34,
+	5, 42, 6, 5, 33, 25, 42, 42, 40, 2, 16, 25, 42, 42, 5, 0,
+	39, 36, 22, 25, 6, 32, 12, 36, 11, 39, 18, 39, 24, 31, 50, 17,
+	46, 6, 27, 0, 47, 41, 41, 0, 0, 19, 34, 23, 18, 29,
+}
+
+// compatCombos are the colors of OBJ0, OBJ1 and BG as indices of compatColors.
+// Most are whole palettes of 4 colors
+var compatCombos = [...][3]int{
+	{4 * 4, 4 * 4, 29 * 4},     // 0
+	{18 * 4, 18 * 4, 18 * 4},   // 1
+	{20 * 4, 20 * 4, 20 * 4},   // 2
+	{24 * 4, 24 * 4, 24 * 4},   // 3
+	{9 * 4, 9 * 4, 9 * 4},      // 4
+	{0 * 4, 0 * 4, 0 * 4},      // 5
+	{27 * 4, 27 * 4, 27 * 4},   // 6
+	{5 * 4, 5 * 4, 5 * 4},      // 7
+	{12 * 4, 12 * 4, 12 * 4},   // 8
+	{26 * 4, 26 * 4, 26 * 4},   // 9
+	{16 * 4, 8 * 4, 8 * 4},     // 10
+	{4 * 4, 28 * 4, 28 * 4},    // 11
+	{4 * 4, 2 * 4, 2 * 4},      // 12
+	{3 * 4, 4 * 4, 4 * 4},      // 13
+	{4 * 4, 29 * 4, 29 * 4},    // 14
+	{28 * 4, 4 * 4, 28 * 4},    // 15
+	{2 * 4, 17 * 4, 2 * 4},     // 16
+	{16 * 4, 16 * 4, 8 * 4},    // 17
+	{4 * 4, 4 * 4, 7 * 4},      // 18
+	{4 * 4, 4 * 4, 18 * 4},     // 19
+	{4 * 4, 4 * 4, 20 * 4},     // 20
+	{19 * 4, 19 * 4, 9 * 4},    // 21
+	{4*4 - 1, 4*4 - 1, 11 * 4}, // 22. objects start at the last color of the palette before
+	{17 * 4, 17 * 4, 2 * 4},    // 23
+	{4 * 4, 4 * 4, 2 * 4},      // 24
+	{4 * 4, 4 * 4, 3 * 4},      // 25
+	{28 * 4, 28 * 4, 0 * 4},    // 26
+	{3 * 4, 3 * 4, 0 * 4},      // 27
+	{0 * 4, 0 * 4, 1 * 4},      // 28
+	{18 * 4, 22 * 4, 18 * 4},   // 29
+	{20 * 4, 22 * 4, 20 * 4},   // 30
+	{24 * 4, 22 * 4, 24 * 4},   // 31
+	{16 * 4, 22 * 4, 8 * 4},    // 32
+	{17 * 4, 4 * 4, 13 * 4},    // 33
+	{28*4 - 1, 0 * 4, 14 * 4},  // 34. objects start at the last color of the palette before
+	{28*4 - 1, 4 * 4, 15 * 4},  // 35. objects start at the last color of the palette before
+	{19 * 4, 22 * 4, 9 * 4},    // 36
+	{16 * 4, 28 * 4, 10 * 4},   // 37
+	{4 * 4, 23 * 4, 28 * 4},    // 38
+	{17 * 4, 22 * 4, 2 * 4},    // 39
+	{4 * 4, 0 * 4, 2 * 4},      // 40
+	{4 * 4, 28 * 4, 3 * 4},     // 41
+	{28 * 4, 3 * 4, 0 * 4},     // 42
+	{3 * 4, 28 * 4, 4 * 4},     // 43
+	{21 * 4, 28 * 4, 4 * 4},    // 44
+	{3 * 4, 28 * 4, 0 * 4},     // 45
+	{25 * 4, 3 * 4, 28 * 4},    // 46
+	{0 * 4, 28 * 4, 8 * 4},     // 47
+	{4 * 4, 3 * 4, 28 * 4},     // 48
+	{28 * 4, 3 * 4, 6 * 4},     // 49
+	{4 * 4, 28 * 4, 29 * 4},    // 50
+}
+
+// compatColors are the palettes in the boot ROM, 4 colors each
+var compatColors = [...]uint16{
+	0x7fff, 0x32bf, 0x00d0, 0x0000, // 0
+	0x639f, 0x4279, 0x15b0, 0x04cb, // 1
+	0x7fff, 0x6e31, 0x454a, 0x0000, // 2
+	0x7fff, 0x1bef, 0x0200, 0x0000, // 3
+	0x7fff, 0x421f, 0x1cf2, 0x0000, // 4
+	0x7fff, 0x5294, 0x294a, 0x0000, // 5
+	0x7fff, 0x03ff, 0x012f, 0x0000, // 6
+	0x7fff, 0x03ef, 0x01d6, 0x0000, // 7
+	0x7fff, 0x42b5, 0x3dc8, 0x0000, // 8
+	0x7e74, 0x03ff, 0x0180, 0x0000, // 9
+	0x67ff, 0x77ac, 0x1a13, 0x2d6b, // 10
+	0x7ed6, 0x4bff, 0x2175, 0x0000, // 11
+	0x53ff, 0x4a5f, 0x7e52, 0x0000, // 12
+	0x4fff, 0x7ed2, 0x3a4c, 0x1ce0, // 13
+	0x03ed, 0x7fff, 0x255f, 0x0000, // 14
+	0x036a, 0x021f, 0x03ff, 0x7fff, // 15
+	0x7fff, 0x01df, 0x0112, 0x0000, // 16
+	0x231f, 0x035f, 0x00f2, 0x0009, // 17
+	0x7fff, 0x03ea, 0x011f, 0x0000, // 18
+	0x299f, 0x001a, 0x000c, 0x0000, // 19
+	0x7fff, 0x027f, 0x001f, 0x0000, // 20
+	0x7fff, 0x03e0, 0x0206, 0x0120, // 21
+	0x7fff, 0x7eeb, 0x001f, 0x7c00, // 22
+	0x7fff, 0x3fff, 0x7e00, 0x001f, // 23
+	0x7fff, 0x03ff, 0x001f, 0x0000, // 24
+	0x03ff, 0x001f, 0x000c, 0x0000, // 25
+	0x7fff, 0x033f, 0x0193, 0x0000, // 26
+	0x0000, 0x4200, 0x037f, 0x7fff, // 27
+	0x7fff, 0x7e8c, 0x7c00, 0x0000, // 28
+	0x7fff, 0x1bef, 0x6180, 0x0000, // 29
+}
+
+// compatCombination returns the index of compatCombos the boot ROM picks for a DMG game
+func compatCombination(header *cartridge.Header) int {
+	// only games by Nintendo are looked up
+	nintendo := header.OldLicenseeCode == 0x01 ||
+		(header.OldLicenseeCode == 0x33 && header.NewLicenseeCode == "01")
+	if !nintendo {
+		return 0
+	}
+
+	var checksum uint8
+	for _, c := range header.RawTitle {
+		checksum += c
+	}
+
+	for i, val := range compatTitleChecksums {
+		if val != checksum {
+			continue
+		}
+		if i < compatFirstDuplicate {
+			return int(compatCombinations[i])
+		}
+
+		// the 4th letter of the title tells them apart
+		for j := i - compatFirstDuplicate; j < len(compatLetters); j += len(compatTitleChecksums) - compatFirstDuplicate {
+			if compatLetters[j] == header.RawTitle[3] {
+				return int(compatCombinations[compatFirstDuplicate+j])
+			}
+		}
+		return 0
+	}
+
+	return 0
+}
+
+// compatPalettes returns the palettes the CGB boot ROM sets up for a DMG game
+func compatPalettes(header *cartridge.Header) (bg, obj0, obj1 [4]uint16) {
+	combo := compatCombos[compatCombination(header)]
+
+	copy(obj0[:], compatColors[combo[0]:])
+	copy(obj1[:], compatColors[combo[1]:])
+	copy(bg[:], compatColors[combo[2]:])
+	return
+}
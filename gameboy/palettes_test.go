@@ -0,0 +1,93 @@
+package gameboy
+
+import (
+	"gbemu/cartridge"
+	"testing"
+)
+
+// nintendoHeader returns the header of a DMG game by Nintendo with title
+func nintendoHeader(title string) *cartridge.Header {
+	header := &cartridge.Header{Title: title, OldLicenseeCode: 0x33, NewLicenseeCode: "01"}
+	copy(header.RawTitle[:], title)
+	return header
+}
+
+func TestCompatCombination(t *testing.T) {
+	tests := []struct {
+		title string
+		want  int
+	}{
+		{"POKEMON RED", 13},
+		{"POKEMON BLUE", 11},
+		{"POKEMON YELLOW", 3},
+		{"TETRIS", 3},
+		{"ZELDA", 44},
+		// the checksums of these are shared by other titles
+		{"SUPER MARIOLAND", 22},
+		{"METROID2", 46},
+		{"TEST GAME", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			if got := compatCombination(nintendoHeader(tt.title)); got != tt.want {
+				t.Errorf("combination = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompatCombinationLicensee(t *testing.T) {
+	header := nintendoHeader("TETRIS")
+	header.OldLicenseeCode = 0x01
+	if got := compatCombination(header); got != 3 {
+		t.Errorf("old licensee 0x01: combination = %d, want 3", got)
+	}
+
+	// the same title by anyone else is not looked up
+	header.OldLicenseeCode, header.NewLicenseeCode = 0x33, "08"
+	if got := compatCombination(header); got != 0 {
+		t.Errorf("new licensee 08: combination = %d, want 0", got)
+	}
+}
+
+func TestCompatPalettes(t *testing.T) {
+	tests := []struct {
+		name           string
+		header         *cartridge.Header
+		bg, obj0, obj1 [4]uint16
+	}{
+		{
+			name:   "not by Nintendo",
+			header: &cartridge.Header{Title: "TETRIS", OldLicenseeCode: 0x08},
+			bg:     [4]uint16{0x7fff, 0x1bef, 0x6180, 0x0000},
+			obj0:   [4]uint16{0x7fff, 0x421f, 0x1cf2, 0x0000},
+			obj1:   [4]uint16{0x7fff, 0x421f, 0x1cf2, 0x0000},
+		},
+		{
+			name:   "POKEMON RED",
+			header: nintendoHeader("POKEMON RED"),
+			bg:     [4]uint16{0x7fff, 0x421f, 0x1cf2, 0x0000},
+			obj0:   [4]uint16{0x7fff, 0x1bef, 0x0200, 0x0000},
+			obj1:   [4]uint16{0x7fff, 0x421f, 0x1cf2, 0x0000},
+		},
+		{
+			name:   "SUPER MARIOLAND",
+			header: nintendoHeader("SUPER MARIOLAND"),
+			bg:     [4]uint16{0x7ed6, 0x4bff, 0x2175, 0x0000},
+			// the objects start at the last color of palette 3
+			obj0: [4]uint16{0x0000, 0x7fff, 0x421f, 0x1cf2},
+			obj1: [4]uint16{0x0000, 0x7fff, 0x421f, 0x1cf2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bg, obj0, obj1 := compatPalettes(tt.header)
+			if bg != tt.bg || obj0 != tt.obj0 || obj1 != tt.obj1 {
+				t.Errorf("palettes = %04x %04x %04x, want %04x %04x %04x",
+					bg, obj0, obj1, tt.bg, tt.obj0, tt.obj1)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package gameboy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// bump stateVersion whenever a component changes what it saves
+const stateVersion uint16 = 11
+
+var stateMagic = [4]byte{'G', 'B', 'S', 'S'}
+
+var (
+	ErrNotSaveState     = errors.New("gameboy: not a save state")
+	ErrStateForOtherROM = errors.New("gameboy: save state belongs to another ROM")
+)
+
+// StateVersionError is returned when a save state was written by an incompatible version
+type StateVersionError struct {
+	Version uint16
+}
+
+func (e *StateVersionError) Error() string {
+	return fmt.Sprintf("gameboy: unsupported save state version %d (want %d)", e.Version, stateVersion)
+}
+
+// stateHeader is written in front of every save state
+type stateHeader struct {
+	Magic   [4]byte
+	Version uint16
+	// global checksum of the cartridge. 0x14e-0x14f
+	Checksum uint16
+}
+
+// romChecksum is taken from the parsed header, not through the mapper,
+// because bank 0 may not be mapped to 0x0000-0x3fff at the time
+func (machine *Machine) romChecksum() uint16 {
+	return machine.MMU.Header().GlobalChecksum
+}
+
+type stateComponent interface {
+	SaveState(w io.Writer) error
+	LoadState(r io.Reader) error
+}
+
+func (machine *Machine) components() []stateComponent {
+	return []stateComponent{
+		machine.CPU,
+		machine.MMU,
+		machine.GPU,
+		machine.Timer,
+		machine.Joypad,
+		machine.APU,
+	}
+}
+
+// SaveState writes a snapshot of the whole machine
+func (machine *Machine) SaveState(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	header := stateHeader{
+		Magic:    stateMagic,
+		Version:  stateVersion,
+		Checksum: machine.romChecksum(),
+	}
+	if err := binary.Write(bw, binary.LittleEndian, &header); err != nil {
+		return err
+	}
+
+	for _, component := range machine.components() {
+		if err := component.SaveState(bw); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+// LoadState restores a snapshot written by SaveState.
+// If the snapshot is broken, the machine is left as it was.
+func (machine *Machine) LoadState(r io.Reader) error {
+	var header stateHeader
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return ErrNotSaveState
+	}
+
+	if header.Magic != stateMagic {
+		return ErrNotSaveState
+	}
+	if header.Version != stateVersion {
+		return &StateVersionError{header.Version}
+	}
+	if header.Checksum != machine.romChecksum() {
+		return ErrStateForOtherROM
+	}
+
+	// keep the current state to roll back on failure
+	var backup bytes.Buffer
+	if err := machine.SaveState(&backup); err != nil {
+		return err
+	}
+
+	br := bufio.NewReader(r)
+	for _, component := range machine.components() {
+		if err := component.LoadState(br); err != nil {
+			machine.restore(&backup)
+			return err
+		}
+	}
+
+	// the frontend sends the buttons again on the next SetButtons
+	machine.buttons = 0
+	return nil
+}
+
+func (machine *Machine) restore(backup io.Reader) {
+	var header stateHeader
+	binary.Read(backup, binary.LittleEndian, &header)
+
+	for _, component := range machine.components() {
+		component.LoadState(backup)
+	}
+}
@@ -0,0 +1,36 @@
+package gameboy
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLoadStateWithBankSwitched(t *testing.T) {
+	// 1MB MBC1 ROM. bank 0x20 has a different checksum where the header is
+	rom := make([]byte, 0x100000)
+	rom[0x147] = 0x01
+	rom[0x148] = 0x05
+	rom[0x14e], rom[0x14f] = 0x12, 0x34
+	rom[0x20*0x4000+0x14e], rom[0x20*0x4000+0x14f] = 0x56, 0x78
+
+	machine, err := New(rom, Options{Model: ModelDMG})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var state bytes.Buffer
+	if err := machine.SaveState(&state); err != nil {
+		t.Fatal(err)
+	}
+
+	// mode 1 with BANK2 = 1 maps bank 0x20 to 0x0000-0x3fff
+	machine.MMU.Write(0x6000, 1)
+	machine.MMU.Write(0x4000, 1)
+	if machine.MMU.Read(0x14e) != 0x56 {
+		t.Fatal("bank 0x20 is not mapped")
+	}
+
+	if err := machine.LoadState(&state); err != nil {
+		t.Errorf("LoadState with another bank mapped: %v", err)
+	}
+}
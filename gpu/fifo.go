@@ -0,0 +1,462 @@
+package gpu
+
+// pixelFIFO renders pixels one by one as the PPU does, instead of a whole line at once.
+// Changes of SCX, palettes and LCDC in the middle of a line show up,
+// and mode 3 gets longer with fine scrolling, the window and sprites.
+// reference: https://gbdev.io/pandocs/pixel_fifo.html
+type pixelFIFO struct {
+	// background fetcher
+	fetchStep  uint8
+	fetchDots  uint8
+	fetchX     uint8 // tile column from the left of the screen or the window
+	tileNum    uint8
+	tileAttr   uint8
+	tileLow    uint8
+	tileHigh   uint8
+	firstFetch bool // the first fetch of a line is thrown away
+
+	// background FIFO. the fetcher pushes only when it's empty,
+	// so it holds up to a single tile row
+	bgLow  uint8
+	bgHigh uint8
+	bgAttr uint8
+	bgLen  uint8
+
+	// sprite FIFO. slot 0 is the next pixel. color 0 is transparent
+	spriteColor [8]uint8
+	spriteAttr  [8]uint8
+	spriteIndex [8]uint8
+
+	spriteDone uint16 // bit i is set when lineSprites[i] is fetched
+	spriteSlot uint8  // sprite being fetched
+	spriteDots uint8  // remaining dots of the sprite fetch
+
+	lx      uint8 // next pixel on the line
+	discard uint8 // pixels dropped for SCX fine scroll
+
+	window bool // fetching the window on this line
+}
+
+// fetcher steps. each step but push takes 2 dots
+const (
+	fetchTile = iota
+	fetchLow
+	fetchHigh
+	fetchPush
+)
+
+// dots of a sprite fetch once the background fetcher is ready
+const spriteFetchDots = 6
+
+func (fifo *pixelFIFO) stateFields() []interface{} {
+	return []interface{}{
+		&fifo.fetchStep, &fifo.fetchDots, &fifo.fetchX,
+		&fifo.tileNum, &fifo.tileAttr, &fifo.tileLow, &fifo.tileHigh, &fifo.firstFetch,
+		&fifo.bgLow, &fifo.bgHigh, &fifo.bgAttr, &fifo.bgLen,
+		fifo.spriteColor[:], fifo.spriteAttr[:], fifo.spriteIndex[:],
+		&fifo.spriteDone, &fifo.spriteSlot, &fifo.spriteDots,
+		&fifo.lx, &fifo.discard,
+		&fifo.window,
+	}
+}
+
+// SetFIFOMode switches to the pixel FIFO renderer.
+// It's more accurate but slower than the scanline renderer
+func (gpu *GPU) SetFIFOMode() {
+	gpu.fifoMode = true
+}
+
+// updateFIFO runs the PPU dot by dot. 1 dot = 1 tick
+func (gpu *GPU) updateFIFO(ticks uint8) {
+	for i := uint8(0); i < ticks; i++ {
+		gpu.stepDot()
+	}
+}
+
+func (gpu *GPU) stepDot() {
+	gpu.counter++
+
+	// a line is 456 dots. mode 2 is 80 dots and mode 3 ends when 160 pixels are out
+	switch gpu.stat & 0x03 {
+
+	// accessing OAM
+	case 2:
+		if gpu.counter == 80 {
+			gpu.scanOAM()
+			gpu.startPixelTransfer()
+			gpu.stat = gpu.stat&0xf8 | 3
+		}
+
+	// accessing VRAM
+	case 3:
+		gpu.stepPixelTransfer()
+
+		if gpu.fifo.lx == screenWidth {
+			gpu.stat = gpu.stat & 0xf8
+		}
+
+	// horizontal blank
+	case 0:
+		if gpu.counter >= 456 {
+			gpu.counter = 0
+			gpu.ly++
+
+			// the window line only advances on lines the window is drawn
+			if gpu.fifo.window {
+				gpu.windowLine++
+			}
+
+			if gpu.ly >= 144 {
+				// enter v-blank mode
+				gpu.stat = gpu.stat&0xf8 | 1
+				gpu.ReqVBlankInt = true
+			} else {
+				gpu.stat = gpu.stat&0xf8 | 2
+			}
+		}
+
+	// vertical blank
+	case 1:
+		if gpu.counter >= 456 {
+			gpu.counter = 0
+
+			// LY is already 0 at the end of line 153
+			if gpu.ly == 0 || gpu.ly >= 153 {
+				gpu.stat = gpu.stat&0xf8 | 2
+				gpu.ly = 0
+
+				gpu.resetWindow()
+			} else {
+				gpu.ly++
+			}
+		} else if gpu.ly == 153 && gpu.counter >= 4 {
+			// LY=153 only lasts for a few dots before LY reads 0
+			gpu.ly = 0
+		}
+	}
+}
+
+func (gpu *GPU) startPixelTransfer() {
+	fifo := &gpu.fifo
+
+	fifo.fetchStep = fetchTile
+	fifo.fetchDots = 0
+	fifo.fetchX = 0
+	fifo.firstFetch = true
+
+	fifo.bgLen = 0
+	fifo.spriteColor = [8]uint8{}
+	fifo.spriteDone = 0
+	fifo.spriteDots = 0
+
+	fifo.lx = 0
+	fifo.discard = gpu.scx & 7
+
+	fifo.window = false
+	gpu.latchWindowY()
+}
+
+// stepPixelTransfer runs a dot of mode 3
+func (gpu *GPU) stepPixelTransfer() {
+	fifo := &gpu.fifo
+
+	// the output stalls during a sprite fetch
+	if fifo.spriteDots > 0 {
+		fifo.spriteDots--
+		if fifo.spriteDots == 0 {
+			gpu.fetchSprite(fifo.spriteSlot)
+		}
+		return
+	}
+
+	// the window restarts the fetcher from its first tile
+	if !fifo.window && gpu.isWindowVisible() && int(fifo.lx)+7 >= int(gpu.wx) {
+		fifo.window = true
+		fifo.bgLen = 0
+		// WX = 0-6 cuts off the left edge of the window
+		fifo.discard = 0
+		if gpu.wx < 7 {
+			fifo.discard = 7 - gpu.wx
+		}
+		fifo.fetchStep = fetchTile
+		fifo.fetchDots = 0
+		fifo.fetchX = 0
+	}
+
+	if fifo.bgLen > 0 && fifo.discard == 0 {
+		if i := gpu.spriteAt(fifo.lx); i >= 0 {
+			// the sprite fetch waits for the background fetcher to finish
+			if fifo.fetchStep != fetchPush {
+				gpu.stepFetcher()
+				return
+			}
+			fifo.spriteSlot = uint8(i)
+			fifo.spriteDots = spriteFetchDots
+			return
+		}
+	}
+
+	if fifo.bgLen > 0 {
+		gpu.shiftPixel()
+	}
+
+	gpu.stepFetcher()
+}
+
+// spriteAt returns the index in lineSprites of the next sprite to fetch at lx, or -1
+func (gpu *GPU) spriteAt(lx uint8) int {
+	fifo := &gpu.fifo
+
+	if gpu.lcdc&0x2 == 0 {
+		return -1
+	}
+
+	found := -1
+	for i := 0; i < int(gpu.lineSpriteCount); i++ {
+		if fifo.spriteDone>>i&1 > 0 {
+			continue
+		}
+
+		x := gpu.oam[int(gpu.lineSprites[i])*4+1]
+		if x == 0 {
+			// hidden
+			fifo.spriteDone |= 1 << i
+			continue
+		}
+
+		// sprites partially off the left edge are fetched at the first pixel.
+		// on DMG the one with the smaller X goes first among them
+		if int(x)-8 != int(lx) && !(x < 8 && lx == 0) {
+			continue
+		}
+		if found < 0 || (!gpu.cgbMode && x < gpu.oam[int(gpu.lineSprites[found])*4+1]) {
+			found = i
+		}
+	}
+
+	return found
+}
+
+func (gpu *GPU) stepFetcher() {
+	fifo := &gpu.fifo
+
+	if fifo.fetchStep == fetchPush {
+		gpu.pushBG()
+		return
+	}
+
+	fifo.fetchDots++
+	if fifo.fetchDots < 2 {
+		return
+	}
+	fifo.fetchDots = 0
+
+	switch fifo.fetchStep {
+	case fetchTile:
+		gpu.fetchTileNum()
+		fifo.fetchStep = fetchLow
+	case fetchLow:
+		fifo.tileLow = gpu.fetchTileData(0)
+		fifo.fetchStep = fetchHigh
+	case fetchHigh:
+		fifo.tileHigh = gpu.fetchTileData(1)
+		fifo.fetchStep = fetchPush
+		gpu.pushBG()
+	}
+}
+
+// fetchTileNum reads the tile number and the CGB attributes from the tile map
+func (gpu *GPU) fetchTileNum() {
+	fifo := &gpu.fifo
+
+	var base uint16 = 0x1800
+	var x, y uint8
+	if fifo.window {
+		if gpu.lcdc&0x40 != 0 {
+			base = 0x1c00
+		}
+		x = fifo.fetchX
+		y = gpu.windowLine
+	} else {
+		if gpu.lcdc&0x08 != 0 {
+			base = 0x1c00
+		}
+		x = gpu.scx/8 + fifo.fetchX
+		y = gpu.scy + gpu.ly
+	}
+
+	addr := base + uint16(y/8)*32 + uint16(x&31)
+	fifo.tileNum = gpu.vram0[addr]
+
+	fifo.tileAttr = 0
+	if gpu.cgbMode {
+		fifo.tileAttr = gpu.vram1[addr]
+	}
+}
+
+// fetchTileData reads the low (i = 0) or high (i = 1) byte of the tile row
+func (gpu *GPU) fetchTileData(i uint16) uint8 {
+	fifo := &gpu.fifo
+
+	row := (gpu.scy + gpu.ly) & 7
+	if fifo.window {
+		row = gpu.windowLine & 7
+	}
+	// Y flip. CGB only
+	if fifo.tileAttr&0x40 > 0 {
+		row = 7 - row
+	}
+
+	// select tile data 0=8800-97FF or 1=8000-8FFF
+	addr := uint16(fifo.tileNum) * 16
+	if gpu.lcdc&0x10 == 0 {
+		addr = uint16(0x1000 + int(int8(fifo.tileNum))*16)
+	}
+	addr += uint16(row)*2 + i
+
+	// VRAM bank 1. CGB only
+	if fifo.tileAttr&0x8 > 0 {
+		return gpu.vram1[addr]
+	}
+	return gpu.vram0[addr]
+}
+
+// pushBG moves the fetched tile row into the background FIFO if it's empty
+func (gpu *GPU) pushBG() {
+	fifo := &gpu.fifo
+
+	if fifo.bgLen > 0 {
+		return
+	}
+
+	fifo.fetchStep = fetchTile
+
+	if fifo.firstFetch {
+		fifo.firstFetch = false
+		return
+	}
+
+	fifo.bgLow = fifo.tileLow
+	fifo.bgHigh = fifo.tileHigh
+	fifo.bgAttr = fifo.tileAttr
+	// X flip. CGB only
+	if fifo.tileAttr&0x20 > 0 {
+		fifo.bgLow = reverseBits(fifo.bgLow)
+		fifo.bgHigh = reverseBits(fifo.bgHigh)
+	}
+	fifo.bgLen = 8
+	fifo.fetchX++
+}
+
+func reverseBits(b uint8) uint8 {
+	var res uint8
+	for i := 0; i < 8; i++ {
+		res = res<<1 | b>>i&1
+	}
+	return res
+}
+
+// fetchSprite mixes a row of lineSprites[slot] into the sprite FIFO
+func (gpu *GPU) fetchSprite(slot uint8) {
+	fifo := &gpu.fifo
+	fifo.spriteDone |= 1 << slot
+
+	i := int(gpu.lineSprites[slot])
+	y := gpu.oam[i*4]
+	x := gpu.oam[i*4+1]
+	tileNum := gpu.oam[i*4+2]
+	attributes := gpu.oam[i*4+3]
+
+	var height uint8 = 8
+	if gpu.lcdc&0x4 > 0 {
+		height = 16
+		tileNum &= 0xfe
+	}
+
+	row := gpu.ly + 16 - y
+	// Y flip
+	if attributes>>6&1 == 1 {
+		row = height - row - 1
+	}
+	// lower tile of 8x16 sprites
+	if row > 7 {
+		tileNum |= 1
+	}
+
+	addr := uint16(tileNum)*16 + uint16(row&7)*2
+	vram := &gpu.vram0
+	if gpu.cgbMode && attributes&0x8 > 0 {
+		vram = &gpu.vram1
+	}
+	low, high := vram[addr], vram[addr+1]
+
+	for px := 0; px < 8; px++ {
+		b := 7 - px
+		// X flip
+		if attributes>>5&1 == 1 {
+			b = px
+		}
+
+		colorNum := (high>>b&1)<<1 | low>>b&1
+		if colorNum == 0 {
+			continue
+		}
+
+		s := int(x) - 8 + px - int(fifo.lx)
+		if s < 0 || s >= 8 {
+			continue
+		}
+
+		// a pixel of an earlier sprite stays. on CGB the lower OAM index wins
+		if fifo.spriteColor[s] != 0 && !(gpu.cgbMode && uint8(i) < fifo.spriteIndex[s]) {
+			continue
+		}
+
+		fifo.spriteColor[s] = colorNum
+		fifo.spriteAttr[s] = attributes
+		fifo.spriteIndex[s] = uint8(i)
+	}
+}
+
+// shiftPixel pops a pixel from both FIFOs and draws it
+func (gpu *GPU) shiftPixel() {
+	fifo := &gpu.fifo
+
+	fifo.bgLen--
+	colorNum := (fifo.bgHigh>>fifo.bgLen&1)<<1 | fifo.bgLow>>fifo.bgLen&1
+
+	if fifo.discard > 0 {
+		fifo.discard--
+		return
+	}
+
+	spriteColor, spriteAttr := fifo.spriteColor[0], fifo.spriteAttr[0]
+	copy(fifo.spriteColor[:], fifo.spriteColor[1:])
+	copy(fifo.spriteAttr[:], fifo.spriteAttr[1:])
+	copy(fifo.spriteIndex[:], fifo.spriteIndex[1:])
+	fifo.spriteColor[7] = 0
+
+	coord := int(gpu.ly)*screenWidth + int(fifo.lx)
+	fifo.lx++
+
+	// on DMG, LCDC bit 0 turns off the background.
+	// on CGB, it takes the priority away from the background instead
+	bgPalette := gpu.bgp
+	if !gpu.cgbMode && gpu.lcdc&0x1 == 0 {
+		colorNum = 0
+		bgPalette = 0
+	}
+
+	if spriteColor != 0 && gpu.isSpriteVisible(colorNum, fifo.bgAttr&0x80 > 0, spriteAttr) {
+		gpu.paintSpritePixel(coord, spriteColor, spriteAttr)
+		return
+	}
+
+	if gpu.cgbMode {
+		gpu.paintColorPixel(coord, colorNum, fifo.bgAttr&0x7, false)
+	} else if gpu.compatMode {
+		gpu.paintColorPixel(coord, gpu.getNGBColor(colorNum, bgPalette), 0, false)
+	} else {
+		gpu.paintPixel(coord, colorNum, bgPalette)
+	}
+}
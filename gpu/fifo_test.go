@@ -0,0 +1,124 @@
+package gpu
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+const dotsPerFrame = 70224
+
+// newTestScreen returns a DMG GPU with random tiles and maps, and 40 random sprites if sprites is set.
+// The window is enabled when wx is on screen
+func newTestScreen(fifo bool, scx, wx uint8, sprites bool) *GPU {
+	gpu := New()
+	if fifo {
+		gpu.SetFIFOMode()
+	}
+
+	r := rand.New(rand.NewSource(3))
+	for addr := 0x8000; addr < 0xa000; addr++ {
+		gpu.Write(uint16(addr), uint8(r.Intn(256)))
+	}
+
+	if sprites {
+		for i := 0; i < 40; i++ {
+			addr := uint16(0xfe00 + i*4)
+			gpu.Write(addr, uint8(16+r.Intn(150)))
+			gpu.Write(addr+1, uint8(8+i*4))
+			gpu.Write(addr+2, uint8(r.Intn(256)))
+			gpu.Write(addr+3, uint8(r.Intn(256))&0xf0)
+		}
+	}
+
+	gpu.Write(0xff42, 13)
+	gpu.Write(0xff43, scx)
+	gpu.Write(0xff4a, 40)
+	gpu.Write(0xff4b, wx)
+	gpu.Write(0xff47, 0xe4)
+	gpu.Write(0xff48, 0xd2)
+	gpu.Write(0xff49, 0x1b)
+
+	// LCD, BG and sprites on. tile data at 0x8000
+	lcdc := uint8(0x93)
+	if wx <= 166 {
+		// window on with its map at 0x9c00
+		lcdc |= 0x60
+	}
+	gpu.Write(0xff40, lcdc)
+	return gpu
+}
+
+func runFrames(gpu *GPU, frames int) {
+	for i := 0; i < frames*dotsPerFrame/4; i++ {
+		gpu.Update(4)
+	}
+}
+
+func TestFIFOMatchesScanline(t *testing.T) {
+	tests := []struct {
+		name    string
+		scx     uint8
+		wx      uint8
+		sprites bool
+	}{
+		{"BG", 0, 0xff, false},
+		{"BG scrolled", 5, 0xff, false},
+		{"window", 3, 50, false},
+		{"window WX < 7", 0, 3, false},
+		{"window WX=7", 4, 7, true},
+		{"window WX=166", 2, 166, true},
+		{"sprites", 0, 0xff, true},
+		{"sprites and window", 6, 80, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scanline := newTestScreen(false, tt.scx, tt.wx, tt.sprites)
+			fifo := newTestScreen(true, tt.scx, tt.wx, tt.sprites)
+			runFrames(scanline, 3)
+			runFrames(fifo, 3)
+
+			if bytes.Count(scanline.Pixels, scanline.Pixels[:4]) == len(scanline.Pixels)/4 {
+				t.Fatal("the frame is blank")
+			}
+
+			diff := 0
+			for i := 0; i < len(scanline.Pixels); i += 4 {
+				if !bytes.Equal(scanline.Pixels[i:i+4], fifo.Pixels[i:i+4]) {
+					diff++
+				}
+			}
+			if diff > 0 {
+				t.Errorf("%d pixels differ between the renderers", diff)
+			}
+		})
+	}
+}
+
+// mode3Length returns the dots of mode 3 on line
+func mode3Length(gpu *GPU, line uint8) int {
+	for gpu.ly != line || gpu.stat&3 != 2 {
+		gpu.Update(1)
+	}
+	for gpu.stat&3 != 3 {
+		gpu.Update(1)
+	}
+
+	dots := 0
+	for gpu.stat&3 == 3 {
+		gpu.Update(1)
+		dots++
+	}
+	return dots
+}
+
+func TestFIFOMode3Length(t *testing.T) {
+	// SCX%8 pixels are discarded at the start of the line, a dot each
+	for scx := uint8(0); scx < 16; scx++ {
+		gpu := newTestScreen(true, scx, 0xff, false)
+		if got, want := mode3Length(gpu, 60), 172+int(scx%8); got != want {
+			t.Errorf("SCX=%d: mode 3 is %d dots, want %d", scx, got, want)
+		}
+	}
+}
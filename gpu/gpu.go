@@ -40,11 +40,31 @@ type GPU struct {
 	ReqVBlankInt bool
 	ReqLCDInt    bool
 
+	statLine    bool // OR of the STAT interrupt sources. the interrupt is requested on its rising edge
+	statWritten bool // STAT was written since the last update
+
 	cgbMode bool
-	cbgp    [0x40]uint8
-	cbpIdx  uint8
-	cobp    [0x40]uint8
-	cobpIdx uint8
+	// DMG game on CGB. shades are colored by CGB palettes 0 (BG) and 0-1 (OBJ)
+	compatMode bool
+	cbgp       [0x40]uint8
+	cbpIdx     uint8
+	cobp       [0x40]uint8
+	cobpIdx    uint8
+
+	// BG color numbers of the current line and the BG-to-OAM priority of CGB map attributes
+	lineBGColors   [screenWidth]uint8
+	lineBGPriority [screenWidth]bool
+
+	windowTriggered bool  // WY matched LY in this frame
+	windowLine      uint8 // internal line counter of the window. it only counts lines the window is drawn on
+
+	// sprites on the current line selected by the OAM scan
+	lineSprites     [10]uint8
+	lineSpriteCount uint8
+
+	// render with the pixel FIFO instead of a whole scanline at once
+	fifoMode bool
+	fifo     pixelFIFO
 }
 
 func New() *GPU {
@@ -70,6 +90,22 @@ func (gpu *GPU) SetCGBMode() {
 	gpu.cgbMode = true
 }
 
+// SetCompatPalettes colors a DMG game on CGB like the CGB boot ROM does.
+// The shades selected by BGP, OBP0 and OBP1 are looked up in these palettes.
+// Colors are in the CGB format. bit 0-4 red, 5-9 green, 10-14 blue
+func (gpu *GPU) SetCompatPalettes(bg, obj0, obj1 [4]uint16) {
+	gpu.compatMode = true
+
+	for i := 0; i < 4; i++ {
+		gpu.cbgp[i*2] = uint8(bg[i])
+		gpu.cbgp[i*2+1] = uint8(bg[i] >> 8)
+		gpu.cobp[i*2] = uint8(obj0[i])
+		gpu.cobp[i*2+1] = uint8(obj0[i] >> 8)
+		gpu.cobp[8+i*2] = uint8(obj1[i])
+		gpu.cobp[8+i*2+1] = uint8(obj1[i] >> 8)
+	}
+}
+
 func (gpu *GPU) ResetFrame() {
 	for y := 0; y < screenHeight; y++ {
 		for x := 0; x < screenWidth; x++ {
@@ -81,37 +117,38 @@ func (gpu *GPU) ResetFrame() {
 	}
 }
 
+// updateTileSets decodes every tile of both banks. Used after loading a state
 func (gpu *GPU) updateTileSets() {
-	for i := 0; i < 384; i++ {
+	for addr := 0; addr < 384*16; addr += 2 {
+		gpu.updateTileRow(0, addr)
+		gpu.updateTileRow(1, addr)
+	}
+}
 
-		for y := 0; y < 8; y++ {
-			// each tile data is 16 byte
-			data1 := gpu.vram0[i*16+y*2]
-			data2 := gpu.vram0[i*16+y*2+1]
+// updateTileRow decodes the row of the tile containing addr (offset from 0x8000) in a VRAM bank.
+// addresses of the tile maps are ignored
+func (gpu *GPU) updateTileRow(bank uint8, addr int) {
+	if addr >= 384*16 {
+		return
+	}
 
-			for x := 0; x < 8; x++ {
-				b := 7 - x
-				color := (data2>>b&1)<<1 | (data1 >> b & 1)
-				gpu.tileSets[i][y][x] = color
-			}
-		}
+	// each tile data is 16 byte, 2 byte per row
+	i := addr / 16
+	y := addr % 16 / 2
+	addr &^= 1
 
-		if !gpu.cgbMode {
-			continue
-		}
+	vram, tileSets := &gpu.vram0, &gpu.tileSets
+	if bank == 1 {
+		vram, tileSets = &gpu.vram1, &gpu.tileSets2
+	}
 
-		// update tileSets for CGB mode
-		for y := 0; y < 8; y++ {
-			// each tile data is 16 byte
-			data1 := gpu.vram1[i*16+y*2]
-			data2 := gpu.vram1[i*16+y*2+1]
+	data1 := vram[addr]
+	data2 := vram[addr+1]
 
-			for x := 0; x < 8; x++ {
-				b := 7 - x
-				color := (data2>>b&1)<<1 | (data1 >> b & 1)
-				gpu.tileSets2[i][y][x] = color
-			}
-		}
+	for x := 0; x < 8; x++ {
+		b := 7 - x
+		color := (data2>>b&1)<<1 | (data1 >> b & 1)
+		tileSets[i][y][x] = color
 	}
 }
 
@@ -134,13 +171,33 @@ func (gpu *GPU) DumpColorPalette() {
 	// }
 }
 
-func (gpu *GPU) isWindowEnabled() bool {
-	return gpu.lcdc&0x20 != 0 && gpu.wy <= gpu.ly
+// latchWindowY starts the window from the line where LY matches WY.
+// Changing WY later in the frame doesn't move the window
+func (gpu *GPU) latchWindowY() {
+	if gpu.ly == gpu.wy {
+		gpu.windowTriggered = true
+	}
+}
+
+// resetWindow rewinds the window for a new frame
+func (gpu *GPU) resetWindow() {
+	gpu.windowTriggered = false
+	gpu.windowLine = 0
+}
+
+// isWindowVisible reports whether the window is drawn on the current line.
+// The window starts at WX - 7, so WX = 0-6 cuts off its left edge
+// and WX = 166 shows only its first column
+func (gpu *GPU) isWindowVisible() bool {
+	return gpu.lcdc&0x20 != 0 && gpu.windowTriggered && gpu.wx <= 166
 }
 
 func (gpu *GPU) renderScanline() {
-	if gpu.lcdc&0x1 > 0 {
+	// on CGB, LCDC bit 0 only takes the priority away from the background
+	if gpu.cgbMode || gpu.lcdc&0x1 > 0 {
 		gpu.renderBG()
+	} else {
+		gpu.clearBG()
 	}
 
 	if gpu.lcdc&0x2 > 0 {
@@ -148,14 +205,56 @@ func (gpu *GPU) renderScanline() {
 	}
 }
 
-func (gpu *GPU) renderSprites() {
-	for i := 0; i < 40; i++ {
-		y := gpu.oam[i*4] - 16
-		x := gpu.oam[i*4+1] - 8
-		tileNum := gpu.oam[i*4+2]
-		attributes := gpu.oam[i*4+3]
+// scanOAM selects up to 10 sprites on the current line in OAM order.
+// Sprites with X = 0 or off the screen still count toward the limit
+func (gpu *GPU) scanOAM() {
+	height := 8
+	if gpu.lcdc&0x4 > 0 {
+		height = 16
+	}
+
+	gpu.lineSpriteCount = 0
+	for i := 0; i < 40 && gpu.lineSpriteCount < 10; i++ {
+		y := int(gpu.oam[i*4]) - 16
+		if y <= int(gpu.ly) && int(gpu.ly) < y+height {
+			gpu.lineSprites[gpu.lineSpriteCount] = uint8(i)
+			gpu.lineSpriteCount++
+		}
+	}
+}
+
+// spritesByPriority returns the sprites on the line from the highest priority.
+// On DMG the smaller X wins and OAM order breaks ties. On CGB OAM order decides
+func (gpu *GPU) spritesByPriority() ([10]uint8, int) {
+	sprites := gpu.lineSprites
+	n := int(gpu.lineSpriteCount)
+
+	if gpu.cgbMode {
+		return sprites, n
+	}
+
+	// stable insertion sort by X
+	for i := 1; i < n; i++ {
+		for j := i; j > 0 && gpu.oam[int(sprites[j])*4+1] < gpu.oam[int(sprites[j-1])*4+1]; j-- {
+			sprites[j], sprites[j-1] = sprites[j-1], sprites[j]
+		}
+	}
+	return sprites, n
+}
 
-		var height uint8 = 8
+func (gpu *GPU) renderSprites() {
+	// the sprite pixel with the highest priority at each x. colorNum 0 means none
+	var colors [screenWidth]uint8
+	var attrs [screenWidth]uint8
+
+	sprites, n := gpu.spritesByPriority()
+	for _, i := range sprites[:n] {
+		y := int(gpu.oam[int(i)*4]) - 16
+		x := int(gpu.oam[int(i)*4+1]) - 8
+		tileNum := gpu.oam[int(i)*4+2]
+		attributes := gpu.oam[int(i)*4+3]
+
+		height := 8
 		if gpu.lcdc&0x4 > 0 {
 			// use 8x16 mode
 			height = 16
@@ -167,12 +266,7 @@ func (gpu *GPU) renderSprites() {
 			tileNum &= 0xfe
 		}
 
-		// check current line includes sprite
-		if !(y <= gpu.ly && gpu.ly < y+height) {
-			continue
-		}
-
-		tileY := gpu.ly - y
+		tileY := int(gpu.ly) - y
 		// Y flip
 		if attributes>>6&1 == 1 {
 			tileY = height - tileY - 1
@@ -185,112 +279,131 @@ func (gpu *GPU) renderSprites() {
 		}
 
 		for lx := 0; lx < 8; lx++ {
+			sx := x + lx
+			if sx < 0 || sx >= screenWidth || colors[sx] != 0 {
+				continue
+			}
+
 			// X flip
 			tileX := lx
 			if attributes>>5&1 == 1 {
 				tileX = 7 - tileX
 			}
 
-			colorNum := gpu.tileSets[tileNum][tileY%8][tileX%8]
-			if attributes&0x8 > 0 {
+			colorNum := gpu.tileSets[tileNum][tileY%8][tileX]
+			if gpu.cgbMode && attributes&0x8 > 0 {
 				// CGB Mode only. Use VRAM-Bank 1
-				colorNum = gpu.tileSets2[tileNum][tileY%8][tileX%8]
+				colorNum = gpu.tileSets2[tileNum][tileY%8][tileX]
 			}
 
 			// for sprites, colorNum 0 means transparent
-			if colorNum == 0 {
-				continue
-			}
-
-			coord := int(gpu.ly)*screenWidth + (int(x) + lx)
+			colors[sx] = colorNum
+			attrs[sx] = attributes
+		}
+	}
 
-			if (int(x) + lx) > 160 {
-				continue
-			}
-			if coord < 0 || coord >= screenWidth*screenHeight {
-				continue
-			}
+	for sx := 0; sx < screenWidth; sx++ {
+		if colors[sx] == 0 {
+			continue
+		}
 
-			// priority
-			if attributes>>7&1 == 1 {
-				if !gpu.isSpritePrior(coord) {
-					continue
-				}
-			}
+		coord := int(gpu.ly)*screenWidth + sx
 
-			if gpu.cgbMode {
-				// change palette based on the attribute bit2-0
-				paletteNum := attributes & 0x7
-				gpu.paintColorPixel(coord, colorNum, paletteNum, true)
-			} else {
-				// change palette based on the attribute bit4
-				palette := gpu.obp0
-				if attributes>>4&1 == 1 {
-					palette = gpu.obp1
-				}
-				gpu.paintPixel(coord, colorNum, palette)
-			}
+		if !gpu.isSpriteVisible(gpu.lineBGColors[sx], gpu.lineBGPriority[sx], attrs[sx]) {
+			continue
 		}
+
+		gpu.paintSpritePixel(coord, colors[sx], attrs[sx])
 	}
 }
 
-func (gpu *GPU) isSpritePrior(coord int) bool {
-	// check background color and if the back ground color is color num 0
-	// return true
+func (gpu *GPU) paintSpritePixel(coord int, colorNum, attributes uint8) {
+	if gpu.cgbMode {
+		// change palette based on the attribute bit2-0
+		gpu.paintColorPixel(coord, colorNum, attributes&0x7, true)
+		return
+	}
 
-	// get background colors
-	red := gpu.Pixels[coord*4+0]
-	green := gpu.Pixels[coord*4+1]
-	blue := gpu.Pixels[coord*4+2]
+	// change palette based on the attribute bit4
+	paletteNum := attributes >> 4 & 1
+	palette := gpu.obp0
+	if paletteNum == 1 {
+		palette = gpu.obp1
+	}
 
-	// get base color of background palette
-	baseColor := gpu.getNGBColor(0, gpu.bgp)
-	baseRed, baseGreen, baseBlue := getMonochrome(baseColor)
+	if gpu.compatMode {
+		// OBP0 uses OBJ palette 0, OBP1 uses OBJ palette 1
+		gpu.paintColorPixel(coord, gpu.getNGBColor(colorNum, palette), paletteNum, true)
+		return
+	}
+	gpu.paintPixel(coord, colorNum, palette)
+}
 
-	// check current background color is color num 0(base color) or not
-	if red == baseRed && green == baseGreen && blue == baseBlue {
+// isSpriteVisible decides whether a sprite pixel is drawn over the background.
+// bgColor is the BG color number and bgPriority is bit 7 of the CGB map attributes.
+// reference: https://gbdev.io/pandocs/Tile_Maps.html#bg-to-obj-priority-in-cgb-mode
+func (gpu *GPU) isSpriteVisible(bgColor uint8, bgPriority bool, attributes uint8) bool {
+	// BG color 0 is always behind sprites
+	if bgColor == 0 {
 		return true
 	}
 
-	return false
+	if gpu.cgbMode {
+		// LCDC bit 0 is the master priority on CGB. sprites are always on top when it's cleared
+		if gpu.lcdc&0x1 == 0 {
+			return true
+		}
+		if bgPriority {
+			return false
+		}
+	}
+
+	// sprite attribute bit 7 puts BG colors 1-3 over the sprite
+	return attributes&0x80 == 0
 }
 
-func (gpu *GPU) renderBG() {
-	var base uint16
-	if gpu.isWindowEnabled() {
-		if gpu.lcdc&0x40 != 0 {
-			base = 0x1c00
-		} else {
-			base = 0x1800
-		}
-	} else {
-		if gpu.lcdc&0x08 != 0 {
-			base = 0x1c00
+// clearBG draws the DMG background turned off by LCDC bit 0 as white
+func (gpu *GPU) clearBG() {
+	for lx := 0; lx < screenWidth; lx++ {
+		coord := int(gpu.ly)*screenWidth + lx
+		gpu.lineBGColors[lx] = 0
+		gpu.lineBGPriority[lx] = false
+
+		if gpu.compatMode {
+			gpu.paintColorPixel(coord, gpu.getNGBColor(0, 0), 0, false)
 		} else {
-			base = 0x1800
+			gpu.paintPixel(coord, 0, 0)
 		}
 	}
+}
 
-	var y uint16
-	if gpu.isWindowEnabled() {
-		y = uint16(gpu.ly - gpu.wy)
-	} else {
-		y = uint16((gpu.scy + gpu.ly) & 255)
+func (gpu *GPU) renderBG() {
+	// first pixel of the window on this line
+	windowX := screenWidth
+	if gpu.isWindowVisible() {
+		windowX = int(gpu.wx) - 7
 	}
 
-	tileRow := y / 8
-
 	for lx := 0; lx < 160; lx++ {
 
-		var x uint16
-		if gpu.isWindowEnabled() && lx >= int(gpu.wx-7) {
-			x = uint16(lx - int(gpu.wx-7))
+		// (y, x) is coordinate in 256 * 256 full background or the window
+		var base uint16 = 0x1800
+		var x, y uint16
+		if lx >= windowX {
+			if gpu.lcdc&0x40 != 0 {
+				base = 0x1c00
+			}
+			x = uint16(lx - windowX)
+			y = uint16(gpu.windowLine)
 		} else {
+			if gpu.lcdc&0x08 != 0 {
+				base = 0x1c00
+			}
 			x = (uint16(lx) + uint16(gpu.scx)) & 255
+			y = uint16(gpu.scy + gpu.ly)
 		}
 
-		tileCol := x / 8
-		tileAddr := base + tileRow*32 + tileCol
+		tileAddr := base + (y/8)*32 + x/8
 		var tileNum uint16 = uint16(gpu.vram0[tileAddr])
 
 		// read BG map attributes
@@ -303,12 +416,14 @@ func (gpu *GPU) renderBG() {
 			tileNum += 256
 		}
 
-		// (y, x) is coordinate in 256 * 256 full background
 		colorNum := gpu.tileSets[tileNum][y%8][x%8]
 		if tileBankNum > 0 {
 			colorNum = gpu.tileSets2[tileNum][y%8][x%8]
 		}
 
+		gpu.lineBGColors[lx] = colorNum
+		gpu.lineBGPriority[lx] = gpu.cgbMode && attributes&0x80 > 0
+
 		// (ly, lx) is coordinate in 160 * 144 screen
 		coord := int(gpu.ly)*screenWidth + lx
 
@@ -318,10 +433,17 @@ func (gpu *GPU) renderBG() {
 
 		if gpu.cgbMode {
 			gpu.paintColorPixel(coord, colorNum, paletteNum, false)
+		} else if gpu.compatMode {
+			gpu.paintColorPixel(coord, gpu.getNGBColor(colorNum, gpu.bgp), 0, false)
 		} else {
 			gpu.paintPixel(coord, colorNum, gpu.bgp)
 		}
 	}
+
+	// the window line only advances on lines the window is drawn
+	if windowX < screenWidth {
+		gpu.windowLine++
+	}
 }
 
 func (gpu *GPU) paintColorPixel(coord int, colorNum uint8, palette uint8, isSprite bool) {
@@ -475,7 +597,8 @@ func (gpu *GPU) Write(addr uint16, val uint8) {
 		} else {
 			gpu.vram0[addr-0x8000] = val
 		}
-		gpu.updateTileSets()
+		// only the row of the written tile changes
+		gpu.updateTileRow(gpu.vbk, int(addr-0x8000))
 
 		return
 	}
@@ -496,6 +619,7 @@ func (gpu *GPU) Write(addr uint16, val uint8) {
 		// bit 2-0 are Read Only
 		// bit 7 is always set
 		gpu.stat = val&0xf8 | gpu.stat&0x07 | 1<<7
+		gpu.statWritten = true
 	case 0xff42:
 		gpu.scy = val
 	case 0xff43:
@@ -549,33 +673,51 @@ func (gpu *GPU) compareLYC() {
 	// update stat bit-2 coincidence flag
 	if gpu.ly == gpu.lyc {
 		gpu.stat |= 1 << 2
-
-		if gpu.stat>>6&1 == 1 {
-			gpu.ReqLCDInt = true
-		}
-
 	} else {
 		gpu.stat &= ^(uint8(1 << 2))
 	}
 }
 
-func (gpu *GPU) updateLCDInterrupt() {
+// statSources reports whether any of the STAT interrupt sources selected by enables (bit 3-6) is active
+func (gpu *GPU) statSources(enables uint8) bool {
 	mode := gpu.stat & 0x3
 
-	switch mode {
-	case 0: // H-Blank interrupt
-		if gpu.stat>>3&1 == 1 {
-			gpu.ReqLCDInt = true
-		}
-	case 1: // V-Blank interrupt
-		if gpu.stat>>4&1 == 1 {
-			gpu.ReqLCDInt = true
-		}
-	case 2: // OAM interrupt
-		if gpu.stat>>5&1 == 1 {
+	switch {
+	case enables>>6&1 == 1 && gpu.stat>>2&1 == 1: // LY=LYC
+		return true
+	case enables>>3&1 == 1 && mode == 0: // H-Blank
+		return true
+	case enables>>4&1 == 1 && mode == 1: // V-Blank
+		return true
+	case enables>>5&1 == 1 && mode == 2: // OAM
+		return true
+	case enables>>5&1 == 1 && mode == 1 && gpu.ly == 144 && gpu.counter < 4:
+		// the OAM interrupt also fires at the start of line 144
+		return true
+	}
+	return false
+}
+
+// updateStatLine requests the LCD STAT interrupt on a rising edge of the STAT line.
+// All the sources are OR-ed into the line, so a source going up while another one is up
+// doesn't request another interrupt (STAT blocking)
+// reference: https://gbdev.io/pandocs/Interrupt_Sources.html#int-48--stat-interrupt
+func (gpu *GPU) updateStatLine() {
+	line := gpu.statSources(gpu.stat)
+
+	if gpu.statWritten {
+		gpu.statWritten = false
+
+		// DMG bug: writing STAT enables the H-Blank, V-Blank and LY=LYC sources for a cycle
+		if !gpu.cgbMode && !gpu.statLine && gpu.statSources(0x58) {
 			gpu.ReqLCDInt = true
 		}
 	}
+
+	if line && !gpu.statLine {
+		gpu.ReqLCDInt = true
+	}
+	gpu.statLine = line
 }
 
 func (gpu *GPU) Update(ticks uint8) {
@@ -586,12 +728,28 @@ func (gpu *GPU) Update(ticks uint8) {
 		// reference: https://www.reddit.com/r/Gameboy/comments/a1c8h0/what_happens_when_a_gameboy_screen_is_disabled/
 		gpu.counter = 0
 		gpu.ly = 0
+		gpu.resetWindow()
 		gpu.stat = gpu.stat & 0xf8 // enter mode 0.
+		// the line is low while the LCD is off. STAT writes don't request interrupts either
+		gpu.statLine = false
+		gpu.statWritten = false
 		// http://www.codeslinger.co.uk/pages/projects/gameboy/lcd.html
 		// says the mode should be 1. but I found Dr.mario won't past the menu if I set it to 1
 		return
 	}
 
+	if gpu.fifoMode {
+		gpu.updateFIFO(ticks)
+	} else {
+		gpu.updateScanline(ticks)
+	}
+
+	gpu.compareLYC()
+	gpu.updateStatLine()
+}
+
+// updateScanline renders a whole line at the end of mode 3 with fixed mode lengths
+func (gpu *GPU) updateScanline(ticks uint8) {
 	gpu.counter += uint16(ticks)
 
 	// the mode goes through 2 -> 3 -> 0 -> ...
@@ -601,6 +759,8 @@ func (gpu *GPU) Update(ticks uint8) {
 	case 2:
 		if gpu.counter >= 80 {
 			gpu.counter -= 80
+			gpu.scanOAM()
+			gpu.latchWindowY()
 			gpu.stat = gpu.stat&0xf8 | 3
 		}
 
@@ -610,7 +770,6 @@ func (gpu *GPU) Update(ticks uint8) {
 			gpu.counter -= 172
 
 			gpu.stat = gpu.stat & 0xf8
-			gpu.updateLCDInterrupt()
 
 			gpu.renderScanline()
 		}
@@ -628,25 +787,25 @@ func (gpu *GPU) Update(ticks uint8) {
 			} else {
 				gpu.stat = gpu.stat&0xf8 | 2
 			}
-
-			gpu.updateLCDInterrupt()
 		}
 
 	// vertical blank
 	case 1:
 		if gpu.counter >= 456 {
 			gpu.counter -= 456
-			gpu.ly++
 
-			if gpu.ly >= 154 {
+			// LY is already 0 at the end of line 153
+			if gpu.ly == 0 || gpu.ly >= 153 {
 				gpu.stat = gpu.stat&0xf8 | 2
 				gpu.ly = 0
-
-				gpu.updateLCDInterrupt()
+				gpu.resetWindow()
+			} else {
+				gpu.ly++
 			}
+		} else if gpu.ly == 153 && gpu.counter >= 4 {
+			// LY=153 only lasts for a few dots before LY reads 0
+			gpu.ly = 0
 		}
 
 	}
-
-	gpu.compareLYC()
 }
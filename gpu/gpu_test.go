@@ -0,0 +1,189 @@
+package gpu
+
+import "testing"
+
+func TestUpdateTileRow(t *testing.T) {
+	tests := []struct {
+		name string
+		vbk  uint8
+		addr uint16
+		tile int
+		row  int
+	}{
+		{"bank 0 low byte", 0, 0x8000, 0, 0},
+		{"bank 0 high byte", 0, 0x8001, 0, 0},
+		{"bank 0 last row", 0, 0x801e, 1, 7},
+		{"bank 0 last tile", 0, 0x97fe, 383, 7},
+		{"bank 1 low byte", 1, 0x8230, 35, 0},
+		{"bank 1 high byte", 1, 0x8233, 35, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gpu := New()
+			gpu.SetCGBMode()
+			gpu.Write(0xff4f, tt.vbk)
+
+			// color numbers 0, 1, 2, 3, 0, 1, 2, 3 from left
+			low, high := tt.addr&^1, tt.addr|1
+			gpu.Write(low, 0x55)
+			gpu.Write(high, 0x33)
+
+			tileSets, other := &gpu.tileSets, &gpu.tileSets2
+			if tt.vbk == 1 {
+				tileSets, other = other, tileSets
+			}
+
+			want := [8]uint8{0, 1, 2, 3, 0, 1, 2, 3}
+			if got := tileSets[tt.tile][tt.row]; got != want {
+				t.Errorf("row = %v, want %v", got, want)
+			}
+			if got := other[tt.tile][tt.row]; got != [8]uint8{} {
+				t.Errorf("the other bank was decoded: %v", got)
+			}
+		})
+	}
+}
+
+func TestUpdateTileRowMap(t *testing.T) {
+	gpu := New()
+
+	// tile maps are not tile data
+	for addr := uint16(0x9800); addr < 0xa000; addr++ {
+		gpu.Write(addr, 0xff)
+	}
+
+	if gpu.tileSets != [384][8][8]uint8{} {
+		t.Error("writes to the tile maps changed the tile sets")
+	}
+}
+
+// BenchmarkTileUpload writes a full set of 384 tiles through the VRAM port
+func BenchmarkTileUpload(b *testing.B) {
+	gpu := New()
+
+	for i := 0; i < b.N; i++ {
+		for addr := uint16(0x8000); addr < 0x9800; addr++ {
+			gpu.Write(addr, uint8(addr))
+		}
+	}
+}
+
+// stepUntil updates gpu a machine cycle at a time until done returns true
+func stepUntil(t *testing.T, gpu *GPU, done func() bool) {
+	t.Helper()
+
+	for i := 0; !done(); i++ {
+		if i > dotsPerFrame {
+			t.Fatal("timed out")
+		}
+		gpu.Update(4)
+	}
+}
+
+func newStatTestGPU(cgb bool) *GPU {
+	gpu := New()
+	if cgb {
+		gpu.SetCGBMode()
+	}
+	gpu.Write(0xff40, 0x91)
+	return gpu
+}
+
+func TestStatInterrupts(t *testing.T) {
+	tests := []struct {
+		name string
+		stat uint8
+		lyc  uint8
+		want int
+	}{
+		{"H-Blank", 0x08, 200, 144},
+		{"V-Blank", 0x10, 200, 1},
+		{"OAM and line 144", 0x20, 200, 145},
+		{"LY=LYC", 0x40, 10, 1},
+		{"LY=LYC 153", 0x40, 153, 1},
+		{"LY=LYC 0", 0x40, 0, 1},
+		// OAM on lines 1-143 is blocked by H-Blank, and line 144 too
+		{"H-Blank and OAM", 0x28, 200, 145},
+		// OAM on line 0 is blocked by V-Blank
+		{"V-Blank and OAM", 0x30, 200, 144},
+		// LY=LYC on line 10 is blocked by H-Blank of line 9, and blocks H-Blank of line 10
+		{"H-Blank and LY=LYC", 0x48, 10, 143},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gpu := newStatTestGPU(false)
+			gpu.Write(0xff45, tt.lyc)
+			gpu.Write(0xff41, tt.stat)
+			runFrames(gpu, 1)
+
+			got := 0
+			for i := 0; i < dotsPerFrame/4; i++ {
+				gpu.Update(4)
+				if gpu.ReqLCDInt {
+					got++
+				}
+			}
+			if got != tt.want {
+				t.Errorf("%d interrupts in a frame, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLY153(t *testing.T) {
+	gpu := newStatTestGPU(false)
+	stepUntil(t, gpu, func() bool { return gpu.Read(0xff44) == 152 })
+	stepUntil(t, gpu, func() bool { return gpu.Read(0xff44) == 153 })
+
+	gpu.Update(4)
+	if ly, mode := gpu.Read(0xff44), gpu.stat&3; ly != 0 || mode != 1 {
+		t.Errorf("LY = %d in mode %d a machine cycle into line 153, want 0 in mode 1", ly, mode)
+	}
+}
+
+func TestStatWriteBug(t *testing.T) {
+	tests := []struct {
+		name string
+		cgb  bool
+		mode uint8
+		want bool
+	}{
+		{"DMG H-Blank", false, 0, true},
+		{"DMG V-Blank", false, 1, true},
+		{"DMG OAM", false, 2, false},
+		{"CGB H-Blank", true, 0, false},
+		{"CGB V-Blank", true, 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gpu := newStatTestGPU(tt.cgb)
+			gpu.Write(0xff45, 200)
+			stepUntil(t, gpu, func() bool { return gpu.stat&3 == tt.mode })
+
+			gpu.Write(0xff41, 0)
+			gpu.Update(4)
+			if gpu.ReqLCDInt != tt.want {
+				t.Errorf("STAT write requested interrupt = %v, want %v", gpu.ReqLCDInt, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatWriteLCDOff(t *testing.T) {
+	gpu := newStatTestGPU(false)
+	gpu.Write(0xff45, 200)
+
+	gpu.Write(0xff40, 0)
+	gpu.Update(4)
+	gpu.Write(0xff41, 0)
+	gpu.Update(4)
+
+	gpu.Write(0xff40, 0x91)
+	gpu.Update(4)
+	if gpu.ReqLCDInt {
+		t.Error("STAT write while the LCD was off requested an interrupt after turning it on")
+	}
+}
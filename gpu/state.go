@@ -0,0 +1,37 @@
+package gpu
+
+import (
+	"gbemu/utils"
+	"io"
+)
+
+func (gpu *GPU) stateFields() []interface{} {
+	fields := []interface{}{
+		&gpu.counter,
+		gpu.vram0[:], gpu.vram1[:], gpu.oam[:],
+		&gpu.lcdc, &gpu.stat, &gpu.scy, &gpu.scx, &gpu.ly, &gpu.lyc,
+		&gpu.bgp, &gpu.obp0, &gpu.obp1, &gpu.wy, &gpu.wx, &gpu.vbk,
+		&gpu.ReqVBlankInt, &gpu.ReqLCDInt, &gpu.statLine, &gpu.statWritten,
+		&gpu.cgbMode, &gpu.compatMode,
+		gpu.cbgp[:], &gpu.cbpIdx, gpu.cobp[:], &gpu.cobpIdx,
+		gpu.lineSprites[:], &gpu.lineSpriteCount,
+		&gpu.windowTriggered, &gpu.windowLine,
+	}
+	return append(fields, gpu.fifo.stateFields()...)
+}
+
+// SaveState writes VRAM, OAM, palettes and LCD registers
+func (gpu *GPU) SaveState(w io.Writer) error {
+	return utils.WriteState(w, gpu.stateFields())
+}
+
+// LoadState restores the state written by SaveState
+func (gpu *GPU) LoadState(r io.Reader) error {
+	if err := utils.ReadState(r, gpu.stateFields()); err != nil {
+		return err
+	}
+
+	// tile sets are decoded from VRAM
+	gpu.updateTileSets()
+	return nil
+}
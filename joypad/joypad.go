@@ -49,6 +49,11 @@ func (joypad *Joypad) Read() uint8 {
 	return joypad.state
 }
 
+// Pressed reports whether any button is held
+func (joypad *Joypad) Pressed() bool {
+	return joypad.buttonKeys&joypad.directionKeys != 0xf
+}
+
 func (joypad *Joypad) KeyPress(key uint8) {
 	switch key {
 
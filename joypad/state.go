@@ -0,0 +1,23 @@
+package joypad
+
+import (
+	"gbemu/utils"
+	"io"
+)
+
+func (joypad *Joypad) stateFields() []interface{} {
+	return []interface{}{
+		&joypad.state, &joypad.buttonKeys, &joypad.directionKeys,
+		&joypad.ReqJoypadInt,
+	}
+}
+
+// SaveState writes the P1 register and key state
+func (joypad *Joypad) SaveState(w io.Writer) error {
+	return utils.WriteState(w, joypad.stateFields())
+}
+
+// LoadState restores the state written by SaveState
+func (joypad *Joypad) LoadState(r io.Reader) error {
+	return utils.ReadState(r, joypad.stateFields())
+}
@@ -2,20 +2,25 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
-	c "gbemu/cpu"
-	g "gbemu/gpu"
-	j "gbemu/joypad"
-	m "gbemu/mmu"
-	t "gbemu/timer"
+	a "gbemu/apu"
+	"gbemu/camera"
+	"gbemu/gameboy"
+	"gbemu/mmu"
+	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/hajimehoshi/ebiten"
+	"github.com/hajimehoshi/ebiten/audio"
 	"github.com/hajimehoshi/ebiten/ebitenutil"
+	"github.com/hajimehoshi/ebiten/inpututil"
 )
 
-func debugMode(cpu *c.CPU, breakPoint *uint16) bool {
+func debugMode(machine *gameboy.Machine, breakPoint *uint16) bool {
 	fmt.Printf("_")
 	scanner := bufio.NewScanner(os.Stdin)
 	scanner.Scan()
@@ -23,17 +28,14 @@ func debugMode(cpu *c.CPU, breakPoint *uint16) bool {
 
 	switch input {
 	case "d":
-		cpu.Dump()
-		return debugMode(cpu, breakPoint)
+		machine.CPU.Dump()
+		return debugMode(machine, breakPoint)
 	case "i":
-		cpu.PrintNextIns()
-		return debugMode(cpu, breakPoint)
+		machine.CPU.PrintNextIns()
+		return debugMode(machine, breakPoint)
 	case "n":
-		ticks := cpu.Execute()
-		gpu.Update(ticks)
-		timer.Update(ticks)
-		cpu.HandleInterrupts()
-		*breakPoint = cpu.GetPC()
+		machine.StepInstruction()
+		*breakPoint = machine.CPU.GetPC()
 		return true
 	case "c":
 		// loop until end
@@ -44,107 +46,252 @@ func debugMode(cpu *c.CPU, breakPoint *uint16) bool {
 		// quit
 		return false
 	default:
-		ticks := cpu.Execute()
-		gpu.Update(ticks)
-		timer.Update(ticks)
-		cpu.HandleInterrupts()
-		*breakPoint = cpu.GetPC()
+		machine.StepInstruction()
+		*breakPoint = machine.CPU.GetPC()
 		return true
 	}
 }
 
-const (
-	screenWidth  = 160
-	screenHeight = 144
-
-	// GB CPU is 4194304Hz. To get 60FPS, 4194304/60
-	maxTicks = 69905
-)
-
 var (
-	gpu    *g.GPU    = g.New()
-	timer  *t.Timer  = t.New()
-	joypad *j.Joypad = j.New()
-	mmu    *m.MMU    = m.New(gpu, timer, joypad)
-	cpu    *c.CPU    = c.New(mmu)
+	machine *gameboy.Machine
 
 	breakPoint uint16 = 0xffff
+
+	romPath string
+
+	// save state slot selected by 1-4 keys
+	stateSlot = 1
+	// message shown on screen while messageFrames > 0
+	message       string
+	messageFrames int
+
+	// rumble motor of the cartridge
+	rumbling bool
 )
 
-func update(screen *ebiten.Image) error {
+var slotKeys = []ebiten.Key{ebiten.Key1, ebiten.Key2, ebiten.Key3, ebiten.Key4}
+
+// keyboard layout of the joypad
+var buttonKeys = map[ebiten.Key]gameboy.Buttons{
+	ebiten.KeyJ: gameboy.ButtonDown,
+	ebiten.KeyK: gameboy.ButtonUp,
+	ebiten.KeyH: gameboy.ButtonLeft,
+	ebiten.KeyL: gameboy.ButtonRight,
+	ebiten.KeyF: gameboy.ButtonStart,
+	ebiten.KeyD: gameboy.ButtonSelect,
+	ebiten.KeyS: gameboy.ButtonB,
+	ebiten.KeyA: gameboy.ButtonA,
+}
+
+// pathWithExt returns romPath with its extension replaced. e.g. "game.gb" -> "game.sav"
+func pathWithExt(ext string) string {
+	return strings.TrimSuffix(romPath, filepath.Ext(romPath)) + ext
+}
+
+func statePath(slot int) string {
+	return pathWithExt(fmt.Sprintf(".ss%d", slot))
+}
+
+func showMessage(format string, params ...interface{}) {
+	message = fmt.Sprintf(format, params...)
+	messageFrames = 120
+}
+
+func saveState(slot int) error {
+	fp, err := os.Create(statePath(slot))
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	return machine.SaveState(fp)
+}
+
+func loadState(slot int) error {
+	fp, err := os.Open(statePath(slot))
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	return machine.LoadState(fp)
+}
 
-	// reset TotalTicks every update
-	cpu.TotalTicks = 0
+// handleStateKeys handles save state hotkeys
+// 1-4: select slot, F5: save, F9: load
+func handleStateKeys() {
+	for i, key := range slotKeys {
+		if inpututil.IsKeyJustPressed(key) {
+			stateSlot = i + 1
+			showMessage("Slot %d", stateSlot)
+		}
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyF5) {
+		if err := saveState(stateSlot); err != nil {
+			showMessage("Save failed: %v", err)
+		} else {
+			showMessage("Saved slot %d", stateSlot)
+		}
+	}
 
-	for cpu.TotalTicks < maxTicks {
-		ticks := cpu.Execute()
-		gpu.Update(ticks)
-		timer.Update(ticks)
-		cpu.HandleInterrupts()
+	if inpututil.IsKeyJustPressed(ebiten.KeyF9) {
+		if err := loadState(stateSlot); err != nil {
+			showMessage("Load failed: %v", err)
+		} else {
+			showMessage("Loaded slot %d", stateSlot)
+		}
+	}
+}
+
+// handleTilt tilts the Game Boy for MBC7 games.
+// Arrow keys tilt it fully. While the left button is held, the mouse position from the center does.
+func handleTilt() {
+	var x, y float64
+	if ebiten.IsKeyPressed(ebiten.KeyLeft) {
+		x--
+	}
+	if ebiten.IsKeyPressed(ebiten.KeyRight) {
+		x++
+	}
+	if ebiten.IsKeyPressed(ebiten.KeyUp) {
+		y--
+	}
+	if ebiten.IsKeyPressed(ebiten.KeyDown) {
+		y++
+	}
+
+	if ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft) {
+		cx, cy := ebiten.CursorPosition()
+		x = float64(cx-gameboy.ScreenWidth/2) / (gameboy.ScreenWidth / 2)
+		y = float64(cy-gameboy.ScreenHeight/2) / (gameboy.ScreenHeight / 2)
+	}
+
+	machine.SetTilt(x, y)
+}
+
+func update(screen *ebiten.Image) error {
+	handleStateKeys()
+	handleTilt()
+
+	if err := machine.RunFrame(); err != nil {
+		log.Println(err)
 	}
 
 	if ebiten.IsDrawingSkipped() {
 		return nil
 	}
 
-	screen.ReplacePixels(gpu.Pixels)
+	screen.ReplacePixels(machine.Framebuffer())
 
 	// for debug, TPS, FPS
 	msg := fmt.Sprintf("TPS = %0.2f\nFPS = %0.2f", ebiten.CurrentTPS(), ebiten.CurrentFPS())
+	if messageFrames > 0 {
+		messageFrames--
+		msg += "\n" + message
+	}
+	if rumbling {
+		msg += "\n[RUMBLE]"
+	}
 	ebitenutil.DebugPrint(screen, msg)
 
 	// joypad
-	if ebiten.IsKeyPressed(ebiten.KeyJ) {
-		joypad.KeyPress(j.DOWN)
-	} else if ebiten.IsKeyPressed(ebiten.KeyK) {
-		joypad.KeyPress(j.UP)
-	} else if ebiten.IsKeyPressed(ebiten.KeyH) {
-		joypad.KeyPress(j.LEFT)
-	} else if ebiten.IsKeyPressed(ebiten.KeyL) {
-		joypad.KeyPress(j.RIGHT)
-	} else if ebiten.IsKeyPressed(ebiten.KeyF) {
-		joypad.KeyPress(j.START)
-	} else if ebiten.IsKeyPressed(ebiten.KeyD) {
-		joypad.KeyPress(j.SELECT)
-	} else if ebiten.IsKeyPressed(ebiten.KeyS) {
-		joypad.KeyPress(j.B)
-	} else if ebiten.IsKeyPressed(ebiten.KeyA) {
-		joypad.KeyPress(j.A)
-	} else {
-		joypad.ReleaseAll()
+	var buttons gameboy.Buttons
+	for key, button := range buttonKeys {
+		if ebiten.IsKeyPressed(key) {
+			buttons |= button
+		}
 	}
+	machine.SetButtons(buttons)
 
 	return nil
 }
 
+func usage() {
+	fmt.Println("Usage: gbemu [--model=dmg|cgb|auto] [--mapper=NAME] [--camera=PNG|DIR] [--fifo] ROM")
+	flag.PrintDefaults()
+}
+
 func main() {
-	if len(os.Args) < 2 {
+	modelName := flag.String("model", "auto", "hardware to emulate: dmg, cgb or auto (from the cartridge header)")
+	mapperName := flag.String("mapper", "auto", "mapper to use when the detection is wrong: auto, "+strings.Join(mmu.MapperNames(), ", "))
+	cameraPath := flag.String("camera", "", "PNG file or directory of PNG files seen by the Game Boy Camera. a test pattern if empty")
+	pixelFIFO := flag.Bool("fifo", false, "render with the pixel FIFO for mid-scanline effects. slower than the default scanline renderer")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() < 1 {
 		fmt.Println("Too few arguments. Please provide GameBoy ROM")
 		os.Exit(1)
 	}
 
-	fp, err := os.Open(os.Args[1])
+	romPath = flag.Arg(0)
+
+	// allow options after the ROM as well. e.g. gbemu game.gb --model=dmg
+	flag.CommandLine.Parse(flag.Args()[1:])
+
+	model, err := gameboy.ParseModel(*modelName)
 	if err != nil {
-		panic(err)
+		fmt.Println(err)
+		os.Exit(1)
 	}
-	defer fp.Close()
 
-	buf := make([]byte, 0x1000000)
-	nb, err := fp.Read(buf)
+	rom, err := ioutil.ReadFile(romPath)
 	if err != nil {
 		panic(err)
 	}
-	fmt.Printf("Successfully read %d byte\n", nb)
+	fmt.Printf("Successfully read %d byte\n", len(rom))
 
-	mmu.Load(buf)
+	opts := gameboy.Options{
+		SavePath:  pathWithExt(".sav"),
+		Model:     model,
+		PixelFIFO: *pixelFIFO,
+	}
+	if *mapperName != "auto" {
+		opts.Mapper = *mapperName
+	}
+	if *cameraPath != "" {
+		opts.Camera, err = camera.NewSource(*cameraPath)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	machine, err = gameboy.New(rom, opts)
+	if err != nil {
+		fmt.Printf("Failed to load %s: %v\n", romPath, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Cartridge: %s\n", machine.MMU.Header())
+	fmt.Printf("Mapper: %s\n", machine.MMU.MapperName())
+	fmt.Printf("Model: %s\n", machine.Model())
+	if machine.Model() == gameboy.ModelDMG && machine.MMU.Header().IsCGBOnly() {
+		fmt.Println("warning: this game only works on CGB")
+	}
+
+	// ebiten v1 can't vibrate gamepads, so rumble is only shown on screen
+	machine.SetRumbleHandler(func(on bool) {
+		rumbling = on
+	})
 
-	cpu.Reset()
-	if len(os.Args) == 3 && os.Args[2] == "--color" {
-		cpu.SetCGBMode()
-		gpu.SetCGBMode()
+	// ebiten's player drains the APU's sample buffer
+	audioContext, err := audio.NewContext(a.SampleRate)
+	if err != nil {
+		log.Fatal(err)
+	}
+	player, err := audio.NewPlayer(audioContext, machine.APU.Buffer)
+	if err != nil {
+		log.Fatal(err)
+	}
+	player.Play()
+
+	if err := ebiten.Run(update, gameboy.ScreenWidth, gameboy.ScreenHeight, 3, "Game Boy Emulator"); err != nil {
+		log.Fatal(err)
 	}
 
-	if err := ebiten.Run(update, screenWidth, screenHeight, 3, "Game Boy Emulator"); err != nil {
+	// flush battery-backed RAM on exit
+	if err := machine.Close(); err != nil {
 		log.Fatal(err)
 	}
 }
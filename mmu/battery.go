@@ -0,0 +1,69 @@
+package mmu
+
+import (
+	"io/ioutil"
+	"os"
+)
+
+// flush the save file after the game stops writing to RAM for 60 frames
+const saveDelayFrames = 60
+
+// loadRAM restores the battery-backed RAM from the save file.
+// The file is a raw dump of the cartridge RAM, the same layout as other emulators use.
+// The mapper may append its own data. e.g. the clock of MBC3
+func (mmu *MMU) loadRAM() error {
+	if !mmu.hasBattery || mmu.savePath == "" {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(mmu.savePath)
+	if os.IsNotExist(err) {
+		// first time to play
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	mmu.mapper.LoadBatteryData(data)
+	return nil
+}
+
+// SaveRAM writes the battery-backed RAM to the save file
+func (mmu *MMU) SaveRAM() error {
+	if !mmu.hasBattery || mmu.savePath == "" {
+		return nil
+	}
+
+	if err := ioutil.WriteFile(mmu.savePath, mmu.mapper.BatteryData(), 0644); err != nil {
+		return err
+	}
+
+	mmu.ramDirty = false
+	return nil
+}
+
+// SyncRAM should be called once per frame.
+// It flushes the save file once the game has stopped writing to RAM for a while
+// so that progress survives a crash without writing on every single byte.
+func (mmu *MMU) SyncRAM() error {
+	if !mmu.ramDirty {
+		return nil
+	}
+
+	mmu.ramIdleFrames++
+	if mmu.ramIdleFrames < saveDelayFrames {
+		return nil
+	}
+
+	return mmu.SaveRAM()
+}
+
+func (mmu *MMU) markRAMDirty() {
+	if !mmu.hasBattery {
+		return
+	}
+
+	mmu.ramDirty = true
+	mmu.ramIdleFrames = 0
+}
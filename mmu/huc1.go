@@ -0,0 +1,95 @@
+package mmu
+
+import (
+	"gbemu/cartridge"
+	"gbemu/utils"
+	"io"
+)
+
+// huc1 is Hudson's controller with an IR port. It's like MBC1 without the banking mode.
+// 0x0000-0x1fff: 0x0e maps the IR port to 0xa000-0xbfff. Any other value maps RAM.
+// 0x2000-0x3fff: ROM bank, 6 bits
+// 0x4000-0x5fff: RAM bank, 2 bits
+// RAM doesn't have to be enabled.
+// reference: https://gbdev.io/pandocs/HuC1.html
+type huc1 struct {
+	rom cartROM
+	ram cartRAM
+
+	irMode  bool
+	romBank uint8
+	ramBank uint8
+
+	ir IRPort
+}
+
+func newHuC1(header *cartridge.Header, rom []byte) *huc1 {
+	return &huc1{
+		rom:     newCartROM(header, rom),
+		ram:     make(cartRAM, header.RAMSize()),
+		romBank: 1,
+		ir:      &LoopbackIR{},
+	}
+}
+
+func (mbc *huc1) setIRPort(port IRPort) {
+	mbc.ir = port
+}
+
+func (mbc *huc1) ReadROM(addr uint16) uint8 {
+	if addr <= 0x3fff {
+		return mbc.rom.read(0, addr)
+	}
+	return mbc.rom.read(int(mbc.romBank), addr)
+}
+
+func (mbc *huc1) WriteROM(addr uint16, val uint8) {
+	switch {
+	case addr <= 0x1fff:
+		mbc.irMode = val&0xf == 0xe
+
+	case addr <= 0x3fff:
+		mbc.romBank = val & 0x3f
+		if mbc.romBank == 0 {
+			mbc.romBank = 1
+		}
+
+	case addr <= 0x5fff:
+		mbc.ramBank = val & 0x3
+	}
+}
+
+func (mbc *huc1) ReadRAM(addr uint16) uint8 {
+	if mbc.irMode {
+		return readIR(mbc.ir)
+	}
+	return mbc.ram.read(int(mbc.ramBank), addr)
+}
+
+func (mbc *huc1) WriteRAM(addr uint16, val uint8) bool {
+	if mbc.irMode {
+		writeIR(mbc.ir, val)
+		return false
+	}
+	return mbc.ram.write(int(mbc.ramBank), addr, val)
+}
+
+func (mbc *huc1) stateFields() []interface{} {
+	return []interface{}{[]byte(mbc.ram), &mbc.irMode, &mbc.romBank, &mbc.ramBank}
+}
+
+func (mbc *huc1) SaveState(w io.Writer) error {
+	return utils.WriteState(w, mbc.stateFields())
+}
+
+func (mbc *huc1) LoadState(r io.Reader) error {
+	return utils.ReadState(r, mbc.stateFields())
+}
+
+func (mbc *huc1) BatteryData() []byte {
+	return append([]byte{}, mbc.ram...)
+}
+
+func (mbc *huc1) LoadBatteryData(data []byte) {
+	copy(mbc.ram, data)
+}
@@ -0,0 +1,266 @@
+package mmu
+
+import (
+	"encoding/binary"
+	"gbemu/cartridge"
+	"gbemu/utils"
+	"io"
+)
+
+// HuC3 modes selected by writing to 0x0000-0x1fff.
+// They decide what is mapped to 0xa000-0xbfff
+const (
+	huc3ModeRAMReadOnly  = 0x0
+	huc3ModeRAM          = 0xa
+	huc3ModeCommandWrite = 0xb
+	huc3ModeCommandRead  = 0xc
+	huc3ModeSemaphore    = 0xd
+	huc3ModeIR           = 0xe
+)
+
+// HuC3 RTC commands. The upper nibble of the value written in huc3ModeCommandWrite.
+// The lower nibble is the argument.
+const (
+	huc3CmdRead      = 0x1 // read the RTC memory and increment the address
+	huc3CmdWrite     = 0x3 // write the argument to the RTC memory and increment the address
+	huc3CmdAddrLow   = 0x4
+	huc3CmdAddrHigh  = 0x5
+	huc3CmdExtended  = 0x6
+	huc3ExtLatchTime = 0x0 // copy the clock to the RTC memory 0x00-0x05
+	huc3ExtSetTime   = 0x1 // copy the RTC memory 0x00-0x05 to the clock
+	huc3ExtStatus    = 0x2
+	huc3ExtPlayTone  = 0xe
+)
+
+const huc3MinutesPerDay = 24 * 60
+
+// size of the clock data appended to the save file.
+// minutes, days and seconds as 32-bit values, then 64-bit UNIX time
+const huc3ClockSize = 20
+
+// size of the RTC memory appended to the save file after the clock.
+// Older save files end with the clock
+const huc3RTCMemorySize = 0x100
+
+// huc3Clock counts minutes of the day and days with 12 bits each.
+// Like the MBC3 clock, it catches up with the wall clock when it's accessed.
+type huc3Clock struct {
+	seconds uint8
+	minutes uint16
+	days    uint16
+
+	lastUpdate int64
+}
+
+func (clock *huc3Clock) update() {
+	now := timeNow().Unix()
+	elapsed := now - clock.lastUpdate
+	clock.lastUpdate = now
+
+	if elapsed <= 0 {
+		return
+	}
+
+	seconds := int64(clock.seconds) + elapsed
+	minutes := int64(clock.minutes) + seconds/60
+	days := int64(clock.days) + minutes/huc3MinutesPerDay
+
+	clock.seconds = uint8(seconds % 60)
+	clock.minutes = uint16(minutes % huc3MinutesPerDay)
+	clock.days = uint16(days & 0xfff)
+}
+
+// huc3 is Hudson's controller with a clock, a speaker and an IR port.
+// The clock is accessed through commands with 4-bit RTC memory of 256 addresses.
+// 0x0000-0x1fff: mode. see huc3Mode*
+// 0x2000-0x3fff: ROM bank, 7 bits
+// 0x4000-0x5fff: RAM bank, 2 bits
+// reference: https://gbdev.io/pandocs/HuC3.html
+type huc3 struct {
+	rom cartROM
+	ram cartRAM
+
+	mode    uint8
+	romBank uint8
+	ramBank uint8
+
+	clock     huc3Clock
+	rtcMemory [huc3RTCMemorySize]uint8 // only the lower 4 bits are used
+	address   uint8
+	command   uint8 // last command, read back with the result
+	result    uint8
+
+	ir IRPort
+}
+
+func newHuC3(header *cartridge.Header, rom []byte) *huc3 {
+	return &huc3{
+		rom:     newCartROM(header, rom),
+		ram:     make(cartRAM, header.RAMSize()),
+		romBank: 1,
+		clock:   huc3Clock{lastUpdate: timeNow().Unix()},
+		ir:      &LoopbackIR{},
+	}
+}
+
+func (mbc *huc3) setIRPort(port IRPort) {
+	mbc.ir = port
+}
+
+func (mbc *huc3) ReadROM(addr uint16) uint8 {
+	if addr <= 0x3fff {
+		return mbc.rom.read(0, addr)
+	}
+	return mbc.rom.read(int(mbc.romBank), addr)
+}
+
+func (mbc *huc3) WriteROM(addr uint16, val uint8) {
+	switch {
+	case addr <= 0x1fff:
+		mbc.mode = val & 0xf
+
+	case addr <= 0x3fff:
+		mbc.romBank = val & 0x7f
+		if mbc.romBank == 0 {
+			mbc.romBank = 1
+		}
+
+	case addr <= 0x5fff:
+		mbc.ramBank = val & 0x3
+	}
+}
+
+func (mbc *huc3) ReadRAM(addr uint16) uint8 {
+	switch mbc.mode {
+	case huc3ModeRAMReadOnly, huc3ModeRAM:
+		return mbc.ram.read(int(mbc.ramBank), addr)
+	case huc3ModeCommandRead:
+		return 0x80 | mbc.command<<4 | mbc.result
+	case huc3ModeSemaphore:
+		// commands are done right away, so always ready
+		return 0xff
+	case huc3ModeIR:
+		return readIR(mbc.ir)
+	}
+	return 0xff
+}
+
+func (mbc *huc3) WriteRAM(addr uint16, val uint8) bool {
+	switch mbc.mode {
+	case huc3ModeRAM:
+		return mbc.ram.write(int(mbc.ramBank), addr, val)
+	case huc3ModeCommandWrite:
+		return mbc.execute(val>>4&0x7, val&0xf)
+	case huc3ModeIR:
+		writeIR(mbc.ir, val)
+	}
+	return false
+}
+
+// execute runs an RTC command and reports whether it changed the RTC memory or the clock.
+// Latching the time is not reported because it's derived from the clock
+func (mbc *huc3) execute(command uint8, arg uint8) bool {
+	mbc.command = command
+
+	switch command {
+	case huc3CmdRead:
+		mbc.result = mbc.rtcMemory[mbc.address] & 0xf
+		mbc.address++
+
+	case huc3CmdWrite:
+		mbc.rtcMemory[mbc.address] = arg
+		mbc.address++
+		return true
+
+	case huc3CmdAddrLow:
+		mbc.address = mbc.address&0xf0 | arg
+
+	case huc3CmdAddrHigh:
+		mbc.address = mbc.address&0x0f | arg<<4
+
+	case huc3CmdExtended:
+		switch arg {
+		case huc3ExtLatchTime:
+			mbc.clock.update()
+			putNibbles(mbc.rtcMemory[0:3], mbc.clock.minutes)
+			putNibbles(mbc.rtcMemory[3:6], mbc.clock.days)
+		case huc3ExtSetTime:
+			mbc.clock.update()
+			mbc.clock.seconds = 0
+			mbc.clock.minutes = getNibbles(mbc.rtcMemory[0:3]) % huc3MinutesPerDay
+			mbc.clock.days = getNibbles(mbc.rtcMemory[3:6])
+			return true
+		case huc3ExtStatus:
+			mbc.result = 1
+		case huc3ExtPlayTone:
+			// the speaker in the cartridge is not emulated, so no tone is played
+		}
+	}
+	return false
+}
+
+// putNibbles stores val in 4-bit cells, the least significant nibble first
+func putNibbles(cells []uint8, val uint16) {
+	for i := range cells {
+		cells[i] = uint8(val>>(4*uint(i))) & 0xf
+	}
+}
+
+func getNibbles(cells []uint8) uint16 {
+	val := uint16(0)
+	for i := range cells {
+		val |= uint16(cells[i]&0xf) << (4 * uint(i))
+	}
+	return val
+}
+
+func (mbc *huc3) stateFields() []interface{} {
+	return []interface{}{
+		[]byte(mbc.ram), &mbc.mode, &mbc.romBank, &mbc.ramBank,
+		&mbc.clock.seconds, &mbc.clock.minutes, &mbc.clock.days, &mbc.clock.lastUpdate,
+		mbc.rtcMemory[:], &mbc.address, &mbc.command, &mbc.result,
+	}
+}
+
+func (mbc *huc3) SaveState(w io.Writer) error {
+	return utils.WriteState(w, mbc.stateFields())
+}
+
+func (mbc *huc3) LoadState(r io.Reader) error {
+	return utils.ReadState(r, mbc.stateFields())
+}
+
+// BatteryData returns RAM followed by the clock and the RTC memory
+func (mbc *huc3) BatteryData() []byte {
+	mbc.clock.update()
+
+	data := make([]byte, huc3ClockSize)
+	binary.LittleEndian.PutUint32(data[0:], uint32(mbc.clock.minutes))
+	binary.LittleEndian.PutUint32(data[4:], uint32(mbc.clock.days))
+	binary.LittleEndian.PutUint32(data[8:], uint32(mbc.clock.seconds))
+	binary.LittleEndian.PutUint64(data[12:], uint64(mbc.clock.lastUpdate))
+
+	data = append(append([]byte{}, mbc.ram...), data...)
+	return append(data, mbc.rtcMemory[:]...)
+}
+
+// LoadBatteryData loads save files with or without the RTC memory
+func (mbc *huc3) LoadBatteryData(data []byte) {
+	copy(mbc.ram, data)
+
+	switch len(data) {
+	case len(mbc.ram) + huc3ClockSize:
+	case len(mbc.ram) + huc3ClockSize + huc3RTCMemorySize:
+		copy(mbc.rtcMemory[:], data[len(mbc.ram)+huc3ClockSize:])
+	default:
+		return
+	}
+	data = data[len(mbc.ram):]
+	mbc.clock.minutes = uint16(binary.LittleEndian.Uint32(data[0:])) % huc3MinutesPerDay
+	mbc.clock.days = uint16(binary.LittleEndian.Uint32(data[4:])) & 0xfff
+	mbc.clock.seconds = uint8(binary.LittleEndian.Uint32(data[8:]) % 60)
+	mbc.clock.lastUpdate = int64(binary.LittleEndian.Uint64(data[12:]))
+
+	// catch up with the time the emulator was closed
+	mbc.clock.update()
+}
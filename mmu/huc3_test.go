@@ -0,0 +1,126 @@
+package mmu
+
+import (
+	"gbemu/cartridge"
+	"testing"
+	"time"
+)
+
+// fakeClock makes timeNow return the time set by the test until it's restored
+func fakeClock(t *testing.T) *time.Time {
+	now := time.Unix(1600000000, 0)
+	timeNow = func() time.Time { return now }
+	t.Cleanup(func() { timeNow = time.Now })
+	return &now
+}
+
+func newTestHuC3() *huc3 {
+	return newHuC3(&cartridge.Header{CartridgeType: 0xfe, RAMSizeCode: 0x03}, testROM(8))
+}
+
+// huc3Command runs an RTC command and reports whether it changed the battery data
+func huc3Command(mbc *huc3, command, arg uint8) bool {
+	mbc.WriteROM(0x0000, huc3ModeCommandWrite)
+	return mbc.WriteRAM(0xa000, command<<4|arg)
+}
+
+// huc3Result reads back the last command and its result
+func huc3Result(mbc *huc3) uint8 {
+	mbc.WriteROM(0x0000, huc3ModeCommandRead)
+	return mbc.ReadRAM(0xa000)
+}
+
+func huc3SetAddress(mbc *huc3, addr uint8) {
+	huc3Command(mbc, huc3CmdAddrLow, addr&0xf)
+	huc3Command(mbc, huc3CmdAddrHigh, addr>>4)
+}
+
+func TestHuC3Commands(t *testing.T) {
+	mbc := newTestHuC3()
+
+	tests := []struct {
+		name        string
+		command     uint8
+		arg         uint8
+		wantChanged bool
+		wantResult  uint8
+	}{
+		{"address low", huc3CmdAddrLow, 0x2, false, 0x80 | huc3CmdAddrLow<<4},
+		{"address high", huc3CmdAddrHigh, 0x1, false, 0x80 | huc3CmdAddrHigh<<4},
+		{"write", huc3CmdWrite, 0x7, true, 0x80 | huc3CmdWrite<<4},
+		{"write the next address", huc3CmdWrite, 0x9, true, 0x80 | huc3CmdWrite<<4},
+		{"back to 0x12", huc3CmdAddrLow, 0x2, false, 0x80 | huc3CmdAddrLow<<4},
+		{"read", huc3CmdRead, 0, false, 0x80 | huc3CmdRead<<4 | 0x7},
+		{"read the next address", huc3CmdRead, 0, false, 0x80 | huc3CmdRead<<4 | 0x9},
+		{"status", huc3CmdExtended, huc3ExtStatus, false, 0x80 | huc3CmdExtended<<4 | 1},
+		{"tone", huc3CmdExtended, huc3ExtPlayTone, false, 0x80 | huc3CmdExtended<<4 | 1},
+	}
+
+	for _, tt := range tests {
+		if got := huc3Command(mbc, tt.command, tt.arg); got != tt.wantChanged {
+			t.Errorf("%s: changed = %v, want %v", tt.name, got, tt.wantChanged)
+		}
+		if got := huc3Result(mbc); got != tt.wantResult {
+			t.Errorf("%s: result = %#02x, want %#02x", tt.name, got, tt.wantResult)
+		}
+	}
+}
+
+func TestHuC3Clock(t *testing.T) {
+	now := fakeClock(t)
+	mbc := newTestHuC3()
+
+	// 4:51 on day 0x45
+	huc3SetAddress(mbc, 0x00)
+	for _, nibble := range []uint8{0x3, 0x2, 0x1, 0x5, 0x4, 0x0} {
+		huc3Command(mbc, huc3CmdWrite, nibble)
+	}
+	if !huc3Command(mbc, huc3CmdExtended, huc3ExtSetTime) {
+		t.Error("setting the time reported no change")
+	}
+
+	*now = now.Add(24*time.Hour + 30*time.Minute)
+	if huc3Command(mbc, huc3CmdExtended, huc3ExtLatchTime) {
+		t.Error("latching the time reported a change")
+	}
+
+	huc3SetAddress(mbc, 0x00)
+	var nibbles [6]uint8
+	for i := range nibbles {
+		huc3Command(mbc, huc3CmdRead, 0)
+		nibbles[i] = huc3Result(mbc) & 0xf
+	}
+	if minutes, days := getNibbles(nibbles[0:3]), getNibbles(nibbles[3:6]); minutes != 0x141 || days != 0x46 {
+		t.Errorf("time = %#03x minutes on day %#03x, want 0x141 on day 0x046", minutes, days)
+	}
+}
+
+func TestHuC3BatteryData(t *testing.T) {
+	now := fakeClock(t)
+	mbc := newTestHuC3()
+	mbc.clock.minutes = 100
+
+	huc3SetAddress(mbc, 0x20)
+	huc3Command(mbc, huc3CmdWrite, 0xa)
+	data := mbc.BatteryData()
+
+	*now = now.Add(time.Minute)
+	loaded := newTestHuC3()
+	loaded.LoadBatteryData(data)
+	if got := loaded.rtcMemory[0x20]; got != 0xa {
+		t.Errorf("RTC memory = %#x after loading, want 0xa", got)
+	}
+	if got := loaded.clock.minutes; got != 101 {
+		t.Errorf("clock = %d minutes after loading, want 101", got)
+	}
+
+	// save files from before the RTC memory was saved end with the clock
+	old := newTestHuC3()
+	old.LoadBatteryData(data[:len(data)-huc3RTCMemorySize])
+	if got := old.clock.minutes; got != 101 {
+		t.Errorf("clock = %d minutes after loading an old save file, want 101", got)
+	}
+	if got := old.rtcMemory[0x20]; got != 0 {
+		t.Errorf("RTC memory = %#x after loading an old save file, want 0", got)
+	}
+}
@@ -0,0 +1,50 @@
+package mmu
+
+// IRPort is the infrared transceiver of HuC1 and HuC3 cartridges
+type IRPort interface {
+	// SetLED turns the IR LED on or off
+	SetLED(on bool)
+	// ReceivesLight reports whether the sensor sees IR light
+	ReceivesLight() bool
+}
+
+// LoopbackIR is an IRPort that sees its own LED, like a cartridge facing a mirror.
+// It's the default so that IR code runs without another Game Boy.
+type LoopbackIR struct {
+	led bool
+}
+
+func (ir *LoopbackIR) SetLED(on bool) {
+	ir.led = on
+}
+
+func (ir *LoopbackIR) ReceivesLight() bool {
+	return ir.led
+}
+
+// irMapper is a mapper with an IR port
+type irMapper interface {
+	setIRPort(port IRPort)
+}
+
+// readIR returns the value read from 0xa000-0xbfff in IR mode.
+// 0xc1 when light is seen, 0xc0 otherwise
+func readIR(port IRPort) uint8 {
+	if port.ReceivesLight() {
+		return 0xc1
+	}
+	return 0xc0
+}
+
+// writeIR turns the LED on by bit 0 of the value written to 0xa000-0xbfff in IR mode
+func writeIR(port IRPort, val uint8) {
+	port.SetLED(val&1 > 0)
+}
+
+// SetIRPort connects port to the IR transceiver of the cartridge.
+// It does nothing if the cartridge doesn't have one.
+func (mmu *MMU) SetIRPort(port IRPort) {
+	if mapper, ok := mmu.mapper.(irMapper); ok {
+		mapper.setIRPort(port)
+	}
+}
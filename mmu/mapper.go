@@ -0,0 +1,171 @@
+package mmu
+
+import (
+	"fmt"
+	"gbemu/cartridge"
+	"io"
+	"sort"
+)
+
+// Mapper is the memory bank controller in the cartridge.
+// ROM is mapped to 0x0000-0x7fff and RAM to 0xa000-0xbfff.
+// Writes to ROM go to the registers of the controller.
+type Mapper interface {
+	ReadROM(addr uint16) uint8
+	WriteROM(addr uint16, val uint8)
+	ReadRAM(addr uint16) uint8
+
+	// WriteRAM reports whether it changed what BatteryData returns
+	WriteRAM(addr uint16, val uint8) bool
+
+	// SaveState and LoadState cover the registers and RAM, but not ROM
+	SaveState(w io.Writer) error
+	LoadState(r io.Reader) error
+
+	// BatteryData returns what is kept by the battery, in the save file layout.
+	// LoadBatteryData restores it from the save file.
+	BatteryData() []byte
+	LoadBatteryData(data []byte)
+}
+
+// tickMapper is a mapper with hardware running with the CPU clock
+type tickMapper interface {
+	tick(ticks uint8)
+}
+
+// mapperFunc returns a new mapper for the cartridge
+type mapperFunc func(header *cartridge.Header, rom []byte) Mapper
+
+// mappers by the name used to override the detection
+var mapperFuncs = map[string]mapperFunc{
+	"rom":    func(header *cartridge.Header, rom []byte) Mapper { return newROMOnly(header, rom) },
+	"mbc1":   func(header *cartridge.Header, rom []byte) Mapper { return newMBC1(header, rom) },
+	"mbc2":   func(header *cartridge.Header, rom []byte) Mapper { return newMBC2(header, rom) },
+	"mbc3":   func(header *cartridge.Header, rom []byte) Mapper { return newMBC3(header, rom) },
+	"mbc5":   func(header *cartridge.Header, rom []byte) Mapper { return newMBC5(header, rom) },
+	"mbc7":   func(header *cartridge.Header, rom []byte) Mapper { return newMBC7(header, rom) },
+	"mmm01":  func(header *cartridge.Header, rom []byte) Mapper { return newMMM01(header, rom) },
+	"camera": func(header *cartridge.Header, rom []byte) Mapper { return newPocketCamera(header, rom) },
+	"huc1":   func(header *cartridge.Header, rom []byte) Mapper { return newHuC1(header, rom) },
+	"huc3":   func(header *cartridge.Header, rom []byte) Mapper { return newHuC3(header, rom) },
+	"mbc1m": func(header *cartridge.Header, rom []byte) Mapper {
+		mbc := newMBC1(header, rom)
+		mbc.multicart = true
+		return mbc
+	},
+	"wisdomtree": func(header *cartridge.Header, rom []byte) Mapper { return newWisdomTree(header, rom) },
+	"sachen":     func(header *cartridge.Header, rom []byte) Mapper { return newSachen(header, rom) },
+}
+
+// names of the mappers for the header
+var headerMappers = map[cartridge.Mapper]string{
+	cartridge.ROMOnly:      "rom",
+	cartridge.MBC1:         "mbc1",
+	cartridge.MBC2:         "mbc2",
+	cartridge.MBC3:         "mbc3",
+	cartridge.MBC5:         "mbc5",
+	cartridge.MBC7:         "mbc7",
+	cartridge.MMM01:        "mmm01",
+	cartridge.PocketCamera: "camera",
+	cartridge.HuC1:         "huc1",
+	cartridge.HuC3:         "huc3",
+}
+
+// MapperNames returns the names accepted by Load to override the detection
+func MapperNames() []string {
+	names := []string{}
+	for name := range mapperFuncs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// detectMapper returns the name of the mapper for the cartridge, or "" if it's not supported.
+// Carts lying in their headers are checked first.
+// knownType is false when the cartridge type in the header is unknown.
+func detectMapper(header *cartridge.Header, rom []byte, knownType bool) string {
+	switch {
+	case isMMM01(rom):
+		return "mmm01"
+	case isWisdomTree(rom):
+		return "wisdomtree"
+	case isSachen(rom):
+		return "sachen"
+	}
+
+	if !knownType {
+		return ""
+	}
+	return headerMappers[header.Mapper()]
+}
+
+// newMapper returns the mapper by name. MBC1M is detected by newMBC1 itself
+func newMapper(name string, header *cartridge.Header, rom []byte) (Mapper, error) {
+	fn, ok := mapperFuncs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown mapper %q", name)
+	}
+	return fn(header, rom), nil
+}
+
+// cartROM is the ROM of the cartridge in 16KB banks
+type cartROM struct {
+	data  []byte
+	banks int
+}
+
+// newCartROM uses the larger of the header and the file for the number of banks
+// because unlicensed carts often say 32KB in the header
+func newCartROM(header *cartridge.Header, rom []byte) cartROM {
+	banks := 2
+	for banks*0x4000 < len(rom) || banks < header.ROMBanks() {
+		banks <<= 1
+	}
+	return cartROM{data: rom, banks: banks}
+}
+
+// read reads addr in bank. The bank number wraps around the ROM size
+// like the unconnected upper address lines do
+func (rom *cartROM) read(bank int, addr uint16) uint8 {
+	offset := (bank&(rom.banks-1))<<14 | int(addr&0x3fff)
+	// banks beyond the end of the ROM
+	if offset >= len(rom.data) {
+		return 0xff
+	}
+	return rom.data[offset]
+}
+
+// cartRAM is the external RAM of the cartridge in 8KB banks
+type cartRAM []byte
+
+// offset returns the index of addr in bank.
+// The bank number wraps around the RAM size and RAM smaller than 8KB is mirrored.
+func (ram cartRAM) offset(bank int, addr uint16) int {
+	return (bank*0x2000 + int(addr-0xa000)) % len(ram)
+}
+
+// read returns 0xff when there is no RAM
+func (ram cartRAM) read(bank int, addr uint16) uint8 {
+	if len(ram) == 0 {
+		return 0xff
+	}
+	return ram[ram.offset(bank, addr)]
+}
+
+// write reports whether the value changed
+func (ram cartRAM) write(bank int, addr uint16, val uint8) bool {
+	if len(ram) == 0 {
+		return false
+	}
+	offset := ram.offset(bank, addr)
+	changed := ram[offset] != val
+	ram[offset] = val
+	return changed
+}
+
+// ramEnableValue reports whether val written to 0x0000-0x1fff enables RAM.
+// Only 0x0a in the lower 4 bits enables it. Any other value disables it.
+func ramEnableValue(val uint8) bool {
+	return val&0xf == 0xa
+}
@@ -0,0 +1,324 @@
+package mmu
+
+import (
+	"gbemu/cartridge"
+	"testing"
+)
+
+type mapperWrite struct {
+	addr uint16
+	val  uint8
+}
+
+// testROM returns a ROM with the bank number in the first 2 bytes of each bank
+func testROM(banks int) []byte {
+	rom := make([]byte, banks*0x4000)
+	for bank := 0; bank < banks; bank++ {
+		rom[bank*0x4000] = uint8(bank)
+		rom[bank*0x4000+1] = uint8(bank >> 8)
+	}
+	return rom
+}
+
+// romBankAt returns the bank mapped to the 16KB area starting at base
+func romBankAt(mapper Mapper, base uint16) int {
+	return int(mapper.ReadROM(base)) | int(mapper.ReadROM(base+1))<<8
+}
+
+func newTestMapper(t *testing.T, name string, header *cartridge.Header) Mapper {
+	t.Helper()
+
+	mapper, err := newMapper(name, header, testROM(header.ROMBanks()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mapper
+}
+
+func TestMapperROMBanks(t *testing.T) {
+	tests := []struct {
+		name     string
+		mapper   string
+		romSize  uint8
+		writes   []mapperWrite
+		base     uint16
+		wantBank int
+	}{
+		{"mbc1 initial", "mbc1", 0x05, nil, 0x4000, 1},
+		{"mbc1 bank 0 to 1", "mbc1", 0x05, []mapperWrite{{0x2000, 0}}, 0x4000, 1},
+		{"mbc1 bank1", "mbc1", 0x05, []mapperWrite{{0x2000, 0x05}}, 0x4000, 0x05},
+		{"mbc1 bank2", "mbc1", 0x05, []mapperWrite{{0x2000, 0x05}, {0x4000, 1}}, 0x4000, 0x25},
+		{"mbc1 bank 0x20 to 0x21", "mbc1", 0x05, []mapperWrite{{0x2000, 0x20}, {0x4000, 1}}, 0x4000, 0x21},
+		{"mbc1 mode 0 bank 0", "mbc1", 0x05, []mapperWrite{{0x4000, 1}}, 0x0000, 0},
+		{"mbc1 mode 1 bank 0", "mbc1", 0x05, []mapperWrite{{0x4000, 1}, {0x6000, 1}}, 0x0000, 0x20},
+		{"mbc1 size mask", "mbc1", 0x03, []mapperWrite{{0x2000, 0x15}}, 0x4000, 0x05},
+
+		{"mbc2 bank", "mbc2", 0x03, []mapperWrite{{0x2100, 0x03}}, 0x4000, 0x03},
+		{"mbc2 bank 0 to 1", "mbc2", 0x03, []mapperWrite{{0x2100, 0}}, 0x4000, 1},
+		{"mbc2 RAM enable register", "mbc2", 0x03, []mapperWrite{{0x2000, 0x05}}, 0x4000, 1},
+		{"mbc2 size mask", "mbc2", 0x02, []mapperWrite{{0x2100, 0x0f}}, 0x4000, 0x07},
+
+		{"mbc3 bank", "mbc3", 0x06, []mapperWrite{{0x2000, 0x45}}, 0x4000, 0x45},
+		{"mbc3 bank 0 to 1", "mbc3", 0x06, []mapperWrite{{0x2000, 0}}, 0x4000, 1},
+		{"mbc3 size mask", "mbc3", 0x04, []mapperWrite{{0x2000, 0x45}}, 0x4000, 0x05},
+
+		{"mbc5 bank 0", "mbc5", 0x08, []mapperWrite{{0x2000, 0}}, 0x4000, 0},
+		{"mbc5 bank 9 bits", "mbc5", 0x08, []mapperWrite{{0x2000, 0x34}, {0x3000, 1}}, 0x4000, 0x134},
+		{"mbc5 size mask", "mbc5", 0x05, []mapperWrite{{0x2000, 0x45}}, 0x4000, 0x05},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mapper := newTestMapper(t, tt.mapper, &cartridge.Header{ROMSizeCode: tt.romSize})
+			for _, w := range tt.writes {
+				mapper.WriteROM(w.addr, w.val)
+			}
+
+			if got := romBankAt(mapper, tt.base); got != tt.wantBank {
+				t.Errorf("bank at %#04x = %#x, want %#x", tt.base, got, tt.wantBank)
+			}
+		})
+	}
+}
+
+// RAM cases share the cartridge types and how to select RAM bank 1
+var ramTests = []struct {
+	mapper     string
+	cartType   uint8
+	selectBank []mapperWrite // nil if there is a single bank
+	valueMask  uint8         // bits stored in RAM
+}{
+	{"mbc1", 0x03, []mapperWrite{{0x6000, 1}, {0x4000, 1}}, 0xff},
+	{"mbc2", 0x06, nil, 0x0f},
+	{"mbc3", 0x10, []mapperWrite{{0x4000, 1}}, 0xff},
+	{"mbc5", 0x1b, []mapperWrite{{0x4000, 1}}, 0xff},
+}
+
+func newRAMTestMapper(t *testing.T, name string, cartType uint8) Mapper {
+	t.Helper()
+	// 32KB RAM. MBC2 has its own
+	return newTestMapper(t, name, &cartridge.Header{CartridgeType: cartType, ROMSizeCode: 0x03, RAMSizeCode: 0x03})
+}
+
+func TestMapperRAMEnable(t *testing.T) {
+	for _, tt := range ramTests {
+		t.Run(tt.mapper, func(t *testing.T) {
+			mapper := newRAMTestMapper(t, tt.mapper, tt.cartType)
+			want := 0x05&tt.valueMask | ^tt.valueMask
+
+			if mapper.WriteRAM(0xa000, 0x05) {
+				t.Error("write to disabled RAM reported a change")
+			}
+			if got := mapper.ReadRAM(0xa000); got != 0xff {
+				t.Errorf("disabled RAM read %#02x, want 0xff", got)
+			}
+
+			mapper.WriteROM(0x0000, 0x0a)
+			if mapper.ReadRAM(0xa000) == want {
+				t.Fatal("write to disabled RAM was stored")
+			}
+			if !mapper.WriteRAM(0xa000, 0x05) {
+				t.Error("write to enabled RAM reported no change")
+			}
+			if mapper.WriteRAM(0xa000, 0x05) {
+				t.Error("write of the same value reported a change")
+			}
+			if got := mapper.ReadRAM(0xa000); got != want {
+				t.Errorf("RAM read %#02x, want %#02x", got, want)
+			}
+
+			// only 0x0a in the lower 4 bits enables RAM
+			mapper.WriteROM(0x0000, 0x1b)
+			if got := mapper.ReadRAM(0xa000); got != 0xff {
+				t.Errorf("RAM read %#02x after disabling, want 0xff", got)
+			}
+		})
+	}
+}
+
+func TestMapperRAMBanks(t *testing.T) {
+	for _, tt := range ramTests {
+		if tt.selectBank == nil {
+			continue
+		}
+
+		t.Run(tt.mapper, func(t *testing.T) {
+			mapper := newRAMTestMapper(t, tt.mapper, tt.cartType)
+			mapper.WriteROM(0x0000, 0x0a)
+			mapper.WriteRAM(0xa123, 0x11)
+
+			for _, w := range tt.selectBank {
+				mapper.WriteROM(w.addr, w.val)
+			}
+			if got := mapper.ReadRAM(0xa123); got == 0x11 {
+				t.Fatal("RAM bank 1 reads the value of bank 0")
+			}
+			mapper.WriteRAM(0xa123, 0x22)
+
+			// back to bank 0
+			mapper.WriteROM(0x4000, 0)
+			if got := mapper.ReadRAM(0xa123); got != 0x11 {
+				t.Errorf("RAM bank 0 read %#02x, want 0x11", got)
+			}
+		})
+	}
+}
+
+func TestMapperBatteryData(t *testing.T) {
+	for _, tt := range ramTests {
+		t.Run(tt.mapper, func(t *testing.T) {
+			mapper := newRAMTestMapper(t, tt.mapper, tt.cartType)
+			mapper.WriteROM(0x0000, 0x0a)
+			for addr := uint16(0xa000); addr < 0xa200; addr++ {
+				mapper.WriteRAM(addr, uint8(addr*7))
+			}
+			data := mapper.BatteryData()
+
+			loaded := newRAMTestMapper(t, tt.mapper, tt.cartType)
+			loaded.LoadBatteryData(data)
+			loaded.WriteROM(0x0000, 0x0a)
+
+			for addr := uint16(0xa000); addr < 0xa200; addr++ {
+				want := uint8(addr*7)&tt.valueMask | ^tt.valueMask
+				if got := loaded.ReadRAM(addr); got != want {
+					t.Fatalf("read %#02x at %#04x after loading, want %#02x", got, addr, want)
+				}
+			}
+
+			if got := loaded.BatteryData(); string(got) != string(data) {
+				t.Errorf("battery data changed after a round-trip. %d bytes, want %d", len(got), len(data))
+			}
+		})
+	}
+}
+
+// bankStep is a step of a banking sequence. The writes are done before checking the banks
+type bankStep struct {
+	writes       []mapperWrite
+	bank0, bank1 int // banks at 0x0000 and 0x4000
+}
+
+func runBankSteps(t *testing.T, mapper Mapper, steps []bankStep) {
+	t.Helper()
+
+	for i, step := range steps {
+		for _, w := range step.writes {
+			mapper.WriteROM(w.addr, w.val)
+		}
+		if got0, got1 := romBankAt(mapper, 0x0000), romBankAt(mapper, 0x4000); got0 != step.bank0 || got1 != step.bank1 {
+			t.Errorf("step %d: banks %#x %#x, want %#x %#x", i, got0, got1, step.bank0, step.bank1)
+		}
+	}
+}
+
+// mmm01ROM returns a 1MB MMM01 collection. The first game says MBC1 in its header
+// and the menu in the last 32KB says MMM01
+func mmm01ROM() []byte {
+	rom := testROM(64)
+	rom[0x147] = 0x01
+	rom[len(rom)-0x8000+0x147] = 0x0d
+	return rom
+}
+
+// wisdomTreeROM returns a 128KB Wisdom Tree game saying ROM only in its header
+func wisdomTreeROM() []byte {
+	rom := testROM(8)
+	copy(rom[0x134:], "WISDOM TREE")
+	return rom
+}
+
+// sachenROM returns a 512KB Sachen multicart with the logo scrambled for locked mode
+func sachenROM() []byte {
+	rom := testROM(32)
+	for i, val := range nintendoLogo {
+		rom[sachenLogoAddr(0x104+i)] = val
+	}
+	return rom
+}
+
+func TestDetectMapper(t *testing.T) {
+	plain := testROM(16)
+	plain[0x147] = 0x01
+	copy(plain[0x104:], nintendoLogo)
+
+	tests := []struct {
+		name string
+		rom  []byte
+		want string
+	}{
+		{"header", plain, "mbc1"},
+		{"MMM01 menu in the last 32KB", mmm01ROM(), "mmm01"},
+		{"Wisdom Tree", wisdomTreeROM(), "wisdomtree"},
+		{"Sachen", sachenROM(), "sachen"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := &cartridge.Header{CartridgeType: tt.rom[0x147]}
+			if got := detectMapper(header, tt.rom, true); got != tt.want {
+				t.Errorf("mapper = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMMM01Banks(t *testing.T) {
+	rom := mmm01ROM()
+	mapper, err := newMapper("mmm01", &cartridge.Header{}, rom)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runBankSteps(t, mapper, []bankStep{
+		// unmapped, the menu is in the last 32KB
+		{nil, 0x3e, 0x3f},
+		// the menu picks the game at bank 0x24 with ROM bank bits 2-4 fixed, and maps it
+		{[]mapperWrite{{0x2000, 0x24}, {0x6000, 0x1c << 1}}, 0x3e, 0x3f},
+		{[]mapperWrite{{0x0000, 0x40}}, 0x24, 0x25},
+		// the game changes only bits 0-1
+		{[]mapperWrite{{0x2000, 0x02}}, 0x24, 0x26},
+		{[]mapperWrite{{0x2000, 0x1f}}, 0x24, 0x27},
+		// the zero check is done on the bits the game can change
+		{[]mapperWrite{{0x2000, 0x00}}, 0x24, 0x25},
+		// the offset and the mask are locked, and the game stays mapped
+		{[]mapperWrite{{0x6000, 0}, {0x4000, 0x30}, {0x0000, 0x00}, {0x2000, 0x03}}, 0x24, 0x27},
+	})
+}
+
+func TestWisdomTreeBanks(t *testing.T) {
+	mapper, err := newMapper("wisdomtree", &cartridge.Header{}, wisdomTreeROM())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runBankSteps(t, mapper, []bankStep{
+		{nil, 0, 1},
+		// 32KB banks by the low byte of the address. the value is ignored
+		{[]mapperWrite{{0x0002, 0x00}}, 4, 5},
+		{[]mapperWrite{{0x3f01, 0xff}}, 2, 3},
+		// banks wrap around the ROM size
+		{[]mapperWrite{{0x0007, 0x00}}, 6, 7},
+		// 0x4000-0x7fff has no register
+		{[]mapperWrite{{0x4001, 0x00}}, 6, 7},
+	})
+}
+
+func TestSachenBanks(t *testing.T) {
+	mapper, err := newMapper("sachen", &cartridge.Header{}, sachenROM())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runBankSteps(t, mapper, []bankStep{
+		{nil, 0, 1},
+		// the base and the mask are locked while ROM bank bits 4-5 aren't both set
+		{[]mapperWrite{{0x0000, 0x08}, {0x4000, 0x38}}, 0, 1},
+		{[]mapperWrite{{0x2000, 0x10}}, 0, 0x10},
+		// unlocked
+		{[]mapperWrite{{0x2000, 0x30}, {0x0000, 0x08}, {0x4000, 0x38}}, 0x08, 0x08},
+		// the menu locks the game in at bank 8
+		{[]mapperWrite{{0x2000, 0x02}}, 0x08, 0x0a},
+		{[]mapperWrite{{0x0000, 0x10}, {0x4000, 0x00}}, 0x08, 0x0a},
+		{[]mapperWrite{{0x2000, 0x00}}, 0x08, 0x09},
+	})
+}
@@ -0,0 +1,162 @@
+package mmu
+
+import (
+	"bytes"
+	"gbemu/cartridge"
+	"gbemu/utils"
+	"io"
+)
+
+// MBC1 has two bank registers.
+// BANK1 (0x2000-0x3fff) is the lower 5 bits of the ROM bank. 0 is mapped to 1
+// BANK2 (0x4000-0x5fff) is 2 bits used as the upper bits of the ROM bank or the RAM bank.
+//
+// In mode 0, BANK2 only affects 0x4000-0x7fff.
+// In mode 1, BANK2 also switches 0x0000-0x3fff and the RAM bank.
+// Because the 0 check is done on BANK1 only, banks 0x20, 0x40 and 0x60 can't be
+// mapped to 0x4000-0x7fff. They are read as 0x21, 0x41 and 0x61 instead.
+//
+// MBC1M multicarts wire BANK2 to ROM bank bit 4-5 and BANK1 bit 4 is not connected,
+// so each 256KB game sees its own bank 0.
+// reference: https://gbdev.io/pandocs/MBC1.html
+type mbc1 struct {
+	rom cartROM
+	ram cartRAM
+
+	ramEnabled bool
+	bank1      uint8
+	bank2      uint8
+	mode       uint8
+
+	multicart bool
+}
+
+// Nintendo logo checked by the boot ROM
+var nintendoLogo = []byte{
+	0xCE, 0xED, 0x66, 0x66, 0xCC, 0x0D, 0x00, 0x0B, 0x03, 0x73, 0x00, 0x83, 0x00, 0x0C, 0x00, 0x0D,
+	0x00, 0x08, 0x11, 0x1F, 0x88, 0x89, 0x00, 0x0E, 0xDC, 0xCC, 0x6E, 0xE6, 0xDD, 0xDD, 0xD9, 0x99,
+	0xBB, 0xBB, 0x67, 0x63, 0x6E, 0x0E, 0xEC, 0xCC, 0xDD, 0xDC, 0x99, 0x9F, 0xBB, 0xB9, 0x33, 0x3E,
+}
+
+func newMBC1(header *cartridge.Header, rom []byte) *mbc1 {
+	return &mbc1{
+		rom:       newCartROM(header, rom),
+		ram:       make(cartRAM, header.RAMSize()),
+		bank1:     1,
+		multicart: isMBC1Multicart(rom),
+	}
+}
+
+// isMBC1Multicart detects MBC1M collections.
+// They are 1MB and have a menu and 3 games of 256KB each,
+// so the Nintendo logo is found at the top of banks 0x10, 0x20 and 0x30 as well.
+func isMBC1Multicart(rom []byte) bool {
+	if len(rom) != 0x100000 {
+		return false
+	}
+
+	logos := 0
+	for bank := 0; bank < 0x40; bank += 0x10 {
+		offset := bank*0x4000 + 0x104
+		if bytes.Equal(rom[offset:offset+len(nintendoLogo)], nintendoLogo) {
+			logos++
+		}
+	}
+
+	return logos > 1
+}
+
+// bank2Shift returns the ROM bank bit where BANK2 is wired
+func (mbc *mbc1) bank2Shift() uint {
+	if mbc.multicart {
+		return 4
+	}
+	return 5
+}
+
+// romBank0 returns the bank mapped to 0x0000-0x3fff
+func (mbc *mbc1) romBank0() int {
+	if mbc.mode == 0 {
+		return 0
+	}
+	return int(mbc.bank2) << mbc.bank2Shift()
+}
+
+// romBank returns the bank mapped to 0x4000-0x7fff
+func (mbc *mbc1) romBank() int {
+	bank1 := int(mbc.bank1)
+	if mbc.multicart {
+		bank1 &= 0xf
+	}
+	return int(mbc.bank2)<<mbc.bank2Shift() | bank1
+}
+
+// ramBank returns the RAM bank mapped to 0xa000-0xbfff
+func (mbc *mbc1) ramBank() int {
+	if mbc.mode == 0 {
+		return 0
+	}
+	return int(mbc.bank2)
+}
+
+func (mbc *mbc1) ReadROM(addr uint16) uint8 {
+	if addr <= 0x3fff {
+		return mbc.rom.read(mbc.romBank0(), addr)
+	}
+	return mbc.rom.read(mbc.romBank(), addr)
+}
+
+func (mbc *mbc1) WriteROM(addr uint16, val uint8) {
+	switch {
+	case addr <= 0x1fff:
+		mbc.ramEnabled = ramEnableValue(val)
+
+	case addr <= 0x3fff:
+		mbc.bank1 = val & 0x1f
+		if mbc.bank1 == 0 {
+			mbc.bank1 = 1
+		}
+
+	case addr <= 0x5fff:
+		mbc.bank2 = val & 0x3
+
+	default:
+		mbc.mode = val & 1
+	}
+}
+
+func (mbc *mbc1) ReadRAM(addr uint16) uint8 {
+	if !mbc.ramEnabled {
+		return 0xff
+	}
+	return mbc.ram.read(mbc.ramBank(), addr)
+}
+
+func (mbc *mbc1) WriteRAM(addr uint16, val uint8) bool {
+	if !mbc.ramEnabled {
+		return false
+	}
+	return mbc.ram.write(mbc.ramBank(), addr, val)
+}
+
+func (mbc *mbc1) stateFields() []interface{} {
+	return []interface{}{
+		[]byte(mbc.ram), &mbc.ramEnabled, &mbc.bank1, &mbc.bank2, &mbc.mode,
+	}
+}
+
+func (mbc *mbc1) SaveState(w io.Writer) error {
+	return utils.WriteState(w, mbc.stateFields())
+}
+
+func (mbc *mbc1) LoadState(r io.Reader) error {
+	return utils.ReadState(r, mbc.stateFields())
+}
+
+func (mbc *mbc1) BatteryData() []byte {
+	return append([]byte{}, mbc.ram...)
+}
+
+func (mbc *mbc1) LoadBatteryData(data []byte) {
+	copy(mbc.ram, data)
+}
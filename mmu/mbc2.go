@@ -0,0 +1,90 @@
+package mmu
+
+import (
+	"gbemu/cartridge"
+	"gbemu/utils"
+	"io"
+)
+
+// MBC2 has 512x4 bits RAM built in.
+const mbc2RAMSize = 0x200
+
+// mbc2 supports up to 16 ROM banks.
+// The least significant bit of the upper address byte selects the register.
+// bit 8 = 0: RAM enable, bit 8 = 1: ROM bank number
+type mbc2 struct {
+	rom cartROM
+	ram cartRAM
+
+	ramEnabled bool
+	romBank    uint8
+}
+
+func newMBC2(header *cartridge.Header, rom []byte) *mbc2 {
+	return &mbc2{
+		rom: newCartROM(header, rom),
+		// the header says no RAM, but MBC2 has it inside
+		ram:     make(cartRAM, mbc2RAMSize),
+		romBank: 1,
+	}
+}
+
+func (mbc *mbc2) ReadROM(addr uint16) uint8 {
+	if addr <= 0x3fff {
+		return mbc.rom.read(0, addr)
+	}
+	return mbc.rom.read(int(mbc.romBank), addr)
+}
+
+func (mbc *mbc2) WriteROM(addr uint16, val uint8) {
+	if addr > 0x3fff {
+		return
+	}
+
+	if addr&0x100 == 0 {
+		mbc.ramEnabled = ramEnableValue(val)
+		return
+	}
+
+	// 16 ROM banks. bank 0 is mapped to 1
+	mbc.romBank = val & 0xf
+	if mbc.romBank == 0 {
+		mbc.romBank = 1
+	}
+}
+
+// ReadRAM reads the built-in RAM. It's echoed through 0xa000-0xbfff
+// and only the lower 4 bits exist, so the upper 4 bits are read as 1s
+func (mbc *mbc2) ReadRAM(addr uint16) uint8 {
+	if !mbc.ramEnabled {
+		return 0xff
+	}
+	return mbc.ram.read(0, addr) | 0xf0
+}
+
+func (mbc *mbc2) WriteRAM(addr uint16, val uint8) bool {
+	if !mbc.ramEnabled {
+		return false
+	}
+	return mbc.ram.write(0, addr, val&0xf)
+}
+
+func (mbc *mbc2) stateFields() []interface{} {
+	return []interface{}{[]byte(mbc.ram), &mbc.ramEnabled, &mbc.romBank}
+}
+
+func (mbc *mbc2) SaveState(w io.Writer) error {
+	return utils.WriteState(w, mbc.stateFields())
+}
+
+func (mbc *mbc2) LoadState(r io.Reader) error {
+	return utils.ReadState(r, mbc.stateFields())
+}
+
+func (mbc *mbc2) BatteryData() []byte {
+	return append([]byte{}, mbc.ram...)
+}
+
+func (mbc *mbc2) LoadBatteryData(data []byte) {
+	copy(mbc.ram, data)
+}
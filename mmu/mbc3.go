@@ -0,0 +1,126 @@
+package mmu
+
+import (
+	"gbemu/cartridge"
+	"gbemu/utils"
+	"io"
+)
+
+// mbc3 supports up to 128 ROM banks and 4 RAM banks.
+// Writing 0x08-0x0c to the RAM bank register maps an RTC register to 0xa000-0xbfff instead.
+type mbc3 struct {
+	rom cartROM
+	ram cartRAM
+
+	ramEnabled bool
+	romBank    uint8
+	ramBank    uint8
+
+	// real time clock and the register selected by 0x4000-0x5fff
+	hasTimer    bool
+	rtc         rtc
+	rtcEnabled  bool
+	rtcRegister uint8
+}
+
+func newMBC3(header *cartridge.Header, rom []byte) *mbc3 {
+	return &mbc3{
+		rom:      newCartROM(header, rom),
+		ram:      make(cartRAM, header.RAMSize()),
+		romBank:  1,
+		hasTimer: header.HasTimer(),
+		rtc:      newRTC(),
+	}
+}
+
+func (mbc *mbc3) ReadROM(addr uint16) uint8 {
+	if addr <= 0x3fff {
+		return mbc.rom.read(0, addr)
+	}
+	return mbc.rom.read(int(mbc.romBank), addr)
+}
+
+func (mbc *mbc3) WriteROM(addr uint16, val uint8) {
+	switch {
+	case addr <= 0x1fff:
+		mbc.ramEnabled = ramEnableValue(val)
+
+	case addr <= 0x3fff:
+		mbc.romBank = val & 0x7f
+		if mbc.romBank == 0 {
+			mbc.romBank = 1
+		}
+
+	case addr <= 0x5fff:
+		if rtcSeconds <= val && val <= rtcDayHigh {
+			mbc.rtcEnabled = true
+			mbc.rtcRegister = val
+			return
+		}
+		mbc.rtcEnabled = false
+		mbc.ramBank = val & 0x07
+
+	default:
+		if mbc.hasTimer {
+			mbc.rtc.latch(val)
+		}
+	}
+}
+
+func (mbc *mbc3) ReadRAM(addr uint16) uint8 {
+	if !mbc.ramEnabled {
+		return 0xff
+	}
+	if mbc.rtcEnabled {
+		return mbc.rtc.read(mbc.rtcRegister)
+	}
+	return mbc.ram.read(int(mbc.ramBank), addr)
+}
+
+func (mbc *mbc3) WriteRAM(addr uint16, val uint8) bool {
+	if !mbc.ramEnabled {
+		return false
+	}
+	if mbc.rtcEnabled {
+		// the clock is saved with RAM
+		mbc.rtc.write(mbc.rtcRegister, val)
+		return mbc.hasTimer
+	}
+	return mbc.ram.write(int(mbc.ramBank), addr, val)
+}
+
+func (mbc *mbc3) stateFields() []interface{} {
+	return []interface{}{
+		[]byte(mbc.ram), &mbc.ramEnabled, &mbc.romBank, &mbc.ramBank,
+		&mbc.rtcEnabled, &mbc.rtcRegister,
+		&mbc.rtc.seconds, &mbc.rtc.minutes, &mbc.rtc.hours, &mbc.rtc.days,
+		&mbc.rtc.halt, &mbc.rtc.carry,
+		mbc.rtc.latched[:], &mbc.rtc.latchReg, &mbc.rtc.lastUpdate,
+	}
+}
+
+func (mbc *mbc3) SaveState(w io.Writer) error {
+	return utils.WriteState(w, mbc.stateFields())
+}
+
+func (mbc *mbc3) LoadState(r io.Reader) error {
+	return utils.ReadState(r, mbc.stateFields())
+}
+
+// BatteryData returns RAM followed by the 48 bytes clock data when there is a timer
+func (mbc *mbc3) BatteryData() []byte {
+	data := append([]byte{}, mbc.ram...)
+	if mbc.hasTimer {
+		data = append(data, mbc.rtc.marshal()...)
+	}
+	return data
+}
+
+func (mbc *mbc3) LoadBatteryData(data []byte) {
+	copy(mbc.ram, data)
+
+	// the clock is stored after RAM
+	if mbc.hasTimer && len(data) > len(mbc.ram) {
+		mbc.rtc.unmarshal(data[len(mbc.ram):])
+	}
+}
@@ -0,0 +1,139 @@
+package mmu
+
+import (
+	"gbemu/cartridge"
+	"gbemu/utils"
+	"io"
+)
+
+// mbc5 supports up to 512 ROM banks and 16 RAM banks.
+// Unlike the others, ROM bank 0 can be mapped to 0x4000-0x7fff.
+// On rumble carts, bit 3 of the RAM bank register drives the motor instead,
+// so they have up to 8 RAM banks.
+type mbc5 struct {
+	rom cartROM
+	ram cartRAM
+
+	ramEnabled bool
+	romBankLo  uint8 // 0x2000-0x2fff
+	romBankHi  uint8 // 0x3000-0x3fff. bit 8 of the ROM bank
+	ramBank    uint8
+
+	hasRumble bool
+	rumble    bool
+	onRumble  func(on bool)
+}
+
+func newMBC5(header *cartridge.Header, rom []byte) *mbc5 {
+	return &mbc5{
+		rom:       newCartROM(header, rom),
+		ram:       make(cartRAM, header.RAMSize()),
+		romBankLo: 1,
+		hasRumble: header.HasRumble(),
+	}
+}
+
+// rumbleMapper is a mapper with a rumble motor
+type rumbleMapper interface {
+	setRumbleHandler(fn func(on bool))
+}
+
+func (mbc *mbc5) setRumbleHandler(fn func(on bool)) {
+	mbc.onRumble = fn
+}
+
+// SetRumbleHandler sets fn to be called when the rumble motor turns on or off.
+// It's never called for cartridges without a motor.
+func (mmu *MMU) SetRumbleHandler(fn func(on bool)) {
+	if mapper, ok := mmu.mapper.(rumbleMapper); ok {
+		mapper.setRumbleHandler(fn)
+	}
+}
+
+func (mbc *mbc5) setRumble(on bool) {
+	if on == mbc.rumble {
+		return
+	}
+	mbc.rumble = on
+	if mbc.onRumble != nil {
+		mbc.onRumble(on)
+	}
+}
+
+func (mbc *mbc5) romBank() int {
+	return int(mbc.romBankHi)<<8 | int(mbc.romBankLo)
+}
+
+func (mbc *mbc5) ReadROM(addr uint16) uint8 {
+	if addr <= 0x3fff {
+		return mbc.rom.read(0, addr)
+	}
+	return mbc.rom.read(mbc.romBank(), addr)
+}
+
+func (mbc *mbc5) WriteROM(addr uint16, val uint8) {
+	switch {
+	case addr <= 0x1fff:
+		mbc.ramEnabled = ramEnableValue(val)
+
+	case addr <= 0x2fff:
+		mbc.romBankLo = val
+
+	case addr <= 0x3fff:
+		mbc.romBankHi = val & 1
+
+	case addr <= 0x5fff:
+		if mbc.hasRumble {
+			mbc.ramBank = val & 0x07
+			mbc.setRumble(val&0x08 > 0)
+		} else {
+			mbc.ramBank = val & 0x0f
+		}
+	}
+}
+
+func (mbc *mbc5) ReadRAM(addr uint16) uint8 {
+	if !mbc.ramEnabled {
+		return 0xff
+	}
+	return mbc.ram.read(int(mbc.ramBank), addr)
+}
+
+func (mbc *mbc5) WriteRAM(addr uint16, val uint8) bool {
+	if !mbc.ramEnabled {
+		return false
+	}
+	return mbc.ram.write(int(mbc.ramBank), addr, val)
+}
+
+func (mbc *mbc5) stateFields() []interface{} {
+	return []interface{}{
+		[]byte(mbc.ram), &mbc.ramEnabled, &mbc.romBankLo, &mbc.romBankHi, &mbc.ramBank,
+		&mbc.rumble,
+	}
+}
+
+func (mbc *mbc5) SaveState(w io.Writer) error {
+	return utils.WriteState(w, mbc.stateFields())
+}
+
+func (mbc *mbc5) LoadState(r io.Reader) error {
+	rumble := mbc.rumble
+	if err := utils.ReadState(r, mbc.stateFields()); err != nil {
+		return err
+	}
+
+	// let the frontend know if the motor changed
+	loaded := mbc.rumble
+	mbc.rumble = rumble
+	mbc.setRumble(loaded)
+	return nil
+}
+
+func (mbc *mbc5) BatteryData() []byte {
+	return append([]byte{}, mbc.ram...)
+}
+
+func (mbc *mbc5) LoadBatteryData(data []byte) {
+	copy(mbc.ram, data)
+}
@@ -0,0 +1,384 @@
+package mmu
+
+import (
+	"encoding/binary"
+	"gbemu/cartridge"
+	"gbemu/utils"
+	"io"
+	"strings"
+)
+
+// accelerometer values when the Game Boy is flat. 1g tilts them by about 0x70
+const (
+	accelCenter = 0x81d0
+	accelPerG   = 0x70
+	accelErased = 0x8000
+)
+
+// 93LC56 has 128 words and 93LC66 has 256. Both take 8 bits address
+const eepromCmdLen = 10 // 2 bits opcode and 8 bits address after the start bit
+
+// mbc7 has a 2-axis accelerometer and a 93LC56 serial EEPROM instead of RAM.
+// Command Master has a 93LC66 instead.
+// 0x0000-0x1fff: RAM enable 1, 0x0a
+// 0x2000-0x3fff: ROM bank, 7 bits
+// 0x4000-0x5fff: RAM enable 2, 0x40
+// Both must be enabled to access the registers at 0xa000-0xafff.
+// reference: https://gbdev.io/pandocs/MBC7.html
+type mbc7 struct {
+	rom cartROM
+
+	ramEnabled1 bool
+	ramEnabled2 bool
+	romBank     uint8
+
+	// tilt set by the frontend in g. x > 0 is right, y > 0 is down
+	tiltX float64
+	tiltY float64
+	// latched accelerometer values
+	accelX uint16
+	accelY uint16
+
+	eeprom eeprom93LC
+}
+
+// eeprom93LC is a 93LC56 or 93LC66 serial EEPROM organized as 16-bit words.
+// Commands are shifted in on DI at rising edges of CLK while CS is high,
+// starting with a 1 bit, then 2 bits opcode and 8 bits address.
+// Programming finishes right away. DO reads busy (0) until CS goes low and ready (1) after.
+type eeprom93LC struct {
+	words []uint16
+
+	// pins
+	cs  bool
+	clk bool
+	di  uint8
+	do  uint8
+
+	started      bool
+	command      uint32 // bits shifted in after the start bit
+	commandBits  uint8
+	writeEnabled bool
+
+	// data shifted out on DO by READ
+	reading    bool
+	readAddr   uint8
+	readValue  uint16
+	readRemain uint8
+}
+
+func newMBC7(header *cartridge.Header, rom []byte) *mbc7 {
+	mbc := &mbc7{
+		rom:     newCartROM(header, rom),
+		romBank: 1,
+		accelX:  accelErased,
+		accelY:  accelErased,
+	}
+
+	// the header doesn't tell the EEPROM size
+	words := 128
+	if strings.Contains(header.Title, "COMMAND") {
+		words = 256
+	}
+
+	// blank EEPROM
+	mbc.eeprom.words = make([]uint16, words)
+	for i := range mbc.eeprom.words {
+		mbc.eeprom.words[i] = 0xffff
+	}
+	mbc.eeprom.do = 1
+	return mbc
+}
+
+// tiltMapper is a mapper with an accelerometer
+type tiltMapper interface {
+	setTilt(x, y float64)
+}
+
+func (mbc *mbc7) setTilt(x, y float64) {
+	mbc.tiltX = x
+	mbc.tiltY = y
+}
+
+// SetTilt tilts the cartridge by x and y in g, from -1 to 1.
+// x > 0 tilts to the right and y > 0 tilts toward the bottom.
+// It does nothing if the cartridge doesn't have an accelerometer.
+func (mmu *MMU) SetTilt(x, y float64) {
+	if mapper, ok := mmu.mapper.(tiltMapper); ok {
+		mapper.setTilt(x, y)
+	}
+}
+
+func (mbc *mbc7) ReadROM(addr uint16) uint8 {
+	if addr <= 0x3fff {
+		return mbc.rom.read(0, addr)
+	}
+	return mbc.rom.read(int(mbc.romBank), addr)
+}
+
+func (mbc *mbc7) WriteROM(addr uint16, val uint8) {
+	switch {
+	case addr <= 0x1fff:
+		mbc.ramEnabled1 = ramEnableValue(val)
+
+	case addr <= 0x3fff:
+		mbc.romBank = val & 0x7f
+
+	case addr <= 0x5fff:
+		mbc.ramEnabled2 = val == 0x40
+	}
+}
+
+func (mbc *mbc7) enabled(addr uint16) bool {
+	return mbc.ramEnabled1 && mbc.ramEnabled2 && addr <= 0xafff
+}
+
+func (mbc *mbc7) ReadRAM(addr uint16) uint8 {
+	if !mbc.enabled(addr) {
+		return 0xff
+	}
+
+	switch addr & 0xf0 {
+	case 0x20:
+		return uint8(mbc.accelX)
+	case 0x30:
+		return uint8(mbc.accelX >> 8)
+	case 0x40:
+		return uint8(mbc.accelY)
+	case 0x50:
+		return uint8(mbc.accelY >> 8)
+	case 0x60:
+		return 0x00
+	case 0x80:
+		return mbc.eeprom.read()
+	}
+	return 0xff
+}
+
+func (mbc *mbc7) WriteRAM(addr uint16, val uint8) bool {
+	if !mbc.enabled(addr) {
+		return false
+	}
+
+	switch addr & 0xf0 {
+	case 0x00:
+		// erase the latched values
+		if val == 0x55 {
+			mbc.accelX = accelErased
+			mbc.accelY = accelErased
+		}
+	case 0x10:
+		// latch only after erased
+		if val == 0xaa && mbc.accelX == accelErased && mbc.accelY == accelErased {
+			mbc.accelX = accelValue(mbc.tiltX)
+			mbc.accelY = accelValue(mbc.tiltY)
+		}
+	case 0x80:
+		return mbc.eeprom.write(val)
+	}
+	return false
+}
+
+// accelValue converts g to the accelerometer value
+func accelValue(g float64) uint16 {
+	if g > 1 {
+		g = 1
+	} else if g < -1 {
+		g = -1
+	}
+	return uint16(accelCenter + int(g*accelPerG))
+}
+
+// read returns the pins. bit 7: CS, bit 6: CLK, bit 1: DI, bit 0: DO
+func (eeprom *eeprom93LC) read() uint8 {
+	val := eeprom.di<<1 | eeprom.do
+	if eeprom.cs {
+		val |= 0x80
+	}
+	if eeprom.clk {
+		val |= 0x40
+	}
+	return val
+}
+
+// write sets the pins and reports whether a command changed the words
+func (eeprom *eeprom93LC) write(val uint8) bool {
+	cs := val&0x80 > 0
+	clk := val&0x40 > 0
+	eeprom.di = val >> 1 & 1
+
+	if !cs {
+		// deselecting aborts the command
+		eeprom.cs = false
+		eeprom.clk = clk
+		eeprom.started = false
+		eeprom.reading = false
+		eeprom.do = 1
+		return false
+	}
+
+	rising := clk && !eeprom.clk
+	eeprom.cs = true
+	eeprom.clk = clk
+	if !rising {
+		return false
+	}
+
+	if eeprom.reading {
+		eeprom.shiftOut()
+		return false
+	}
+
+	if !eeprom.started {
+		// wait for the start bit
+		if eeprom.di == 1 {
+			eeprom.started = true
+			eeprom.command = 0
+			eeprom.commandBits = 0
+		}
+		return false
+	}
+
+	eeprom.command = eeprom.command<<1 | uint32(eeprom.di)
+	eeprom.commandBits++
+	return eeprom.execute()
+}
+
+// shiftOut puts the next bit of the word on DO. Reading continues to the next word
+func (eeprom *eeprom93LC) shiftOut() {
+	if eeprom.readRemain == 0 {
+		eeprom.readAddr = uint8((int(eeprom.readAddr) + 1) % len(eeprom.words))
+		eeprom.readValue = eeprom.words[eeprom.readAddr]
+		eeprom.readRemain = 16
+	}
+
+	eeprom.do = uint8(eeprom.readValue>>15) & 1
+	eeprom.readValue <<= 1
+	eeprom.readRemain--
+}
+
+// execute runs the command once enough bits are shifted in.
+// It reports whether the words changed
+func (eeprom *eeprom93LC) execute() bool {
+	if eeprom.commandBits < eepromCmdLen {
+		return false
+	}
+
+	// data bits may follow the address
+	header := eeprom.command >> (eeprom.commandBits - eepromCmdLen)
+	opcode := header >> 8 & 3
+	addr := int(header&0xff) % len(eeprom.words)
+	programming, changed := false, false
+
+	switch opcode {
+	// READ
+	case 2:
+		eeprom.reading = true
+		eeprom.readAddr = uint8(addr)
+		eeprom.readValue = eeprom.words[addr]
+		eeprom.readRemain = 16
+		// dummy bit
+		eeprom.do = 0
+
+	// WRITE. 16 bits data follows
+	case 1:
+		if eeprom.commandBits < eepromCmdLen+16 {
+			return false
+		}
+		if eeprom.writeEnabled {
+			programming = true
+			changed = eeprom.setWords(addr, addr+1, uint16(eeprom.command))
+		}
+		eeprom.do = 1
+
+	// ERASE
+	case 3:
+		if eeprom.writeEnabled {
+			programming = true
+			changed = eeprom.setWords(addr, addr+1, 0xffff)
+		}
+		eeprom.do = 1
+
+	// the upper 2 bits of the address select the command
+	case 0:
+		switch header >> 6 & 3 {
+		// EWDS
+		case 0:
+			eeprom.writeEnabled = false
+		// WRAL. 16 bits data follows
+		case 1:
+			if eeprom.commandBits < eepromCmdLen+16 {
+				return false
+			}
+			if eeprom.writeEnabled {
+				programming = true
+				changed = eeprom.setWords(0, len(eeprom.words), uint16(eeprom.command))
+			}
+		// ERAL
+		case 2:
+			if eeprom.writeEnabled {
+				programming = true
+				changed = eeprom.setWords(0, len(eeprom.words), 0xffff)
+			}
+		// EWEN
+		case 3:
+			eeprom.writeEnabled = true
+		}
+		eeprom.do = 1
+	}
+
+	// busy until CS goes low
+	if programming {
+		eeprom.do = 0
+	}
+
+	// wait for the next start bit
+	eeprom.started = false
+	return changed
+}
+
+// setWords sets the words from start to end to val and reports whether any changed
+func (eeprom *eeprom93LC) setWords(start, end int, val uint16) bool {
+	changed := false
+	for i := start; i < end; i++ {
+		changed = changed || eeprom.words[i] != val
+		eeprom.words[i] = val
+	}
+	return changed
+}
+
+func (mbc *mbc7) stateFields() []interface{} {
+	eeprom := &mbc.eeprom
+	return []interface{}{
+		&mbc.ramEnabled1, &mbc.ramEnabled2, &mbc.romBank, &mbc.accelX, &mbc.accelY,
+		eeprom.words, &eeprom.cs, &eeprom.clk, &eeprom.di, &eeprom.do,
+		&eeprom.started, &eeprom.command, &eeprom.commandBits, &eeprom.writeEnabled,
+		&eeprom.reading, &eeprom.readAddr, &eeprom.readValue, &eeprom.readRemain,
+	}
+}
+
+func (mbc *mbc7) SaveState(w io.Writer) error {
+	return utils.WriteState(w, mbc.stateFields())
+}
+
+func (mbc *mbc7) LoadState(r io.Reader) error {
+	return utils.ReadState(r, mbc.stateFields())
+}
+
+// BatteryData returns the EEPROM in little endian words
+func (mbc *mbc7) BatteryData() []byte {
+	data := make([]byte, len(mbc.eeprom.words)*2)
+	for i, word := range mbc.eeprom.words {
+		binary.LittleEndian.PutUint16(data[i*2:], word)
+	}
+	return data
+}
+
+func (mbc *mbc7) LoadBatteryData(data []byte) {
+	for i := range mbc.eeprom.words {
+		if len(data) < i*2+2 {
+			return
+		}
+		mbc.eeprom.words[i] = binary.LittleEndian.Uint16(data[i*2:])
+	}
+}
@@ -0,0 +1,226 @@
+package mmu
+
+import (
+	"gbemu/cartridge"
+	"testing"
+)
+
+// EEPROM commands as 2 bits opcode and 8 bits address
+const (
+	eepromRead  = 0x200
+	eepromWrite = 0x100
+	eepromErase = 0x300
+	eepromEWDS  = 0x000
+	eepromWRAL  = 0x040
+	eepromERAL  = 0x080
+	eepromEWEN  = 0x0c0
+)
+
+// eepromPins drives the EEPROM of an MBC7 through 0xa080
+type eepromPins struct {
+	t      *testing.T
+	mapper Mapper
+}
+
+func newEEPROMPins(t *testing.T, title string) *eepromPins {
+	mapper := newMBC7(&cartridge.Header{Title: title, CartridgeType: 0x22}, testROM(8))
+	mapper.WriteROM(0x0000, 0x0a)
+	mapper.WriteROM(0x4000, 0x40)
+	return &eepromPins{t: t, mapper: mapper}
+}
+
+// clock shifts bit in with CS high and reports whether the words changed
+func (pins *eepromPins) clock(bit uint16) bool {
+	di := uint8(bit&1) << 1
+	pins.mapper.WriteRAM(0xa080, 0x80|di)
+	return pins.mapper.WriteRAM(0xa080, 0xc0|di)
+}
+
+func (pins *eepromPins) do() uint8 {
+	return pins.mapper.ReadRAM(0xa080) & 1
+}
+
+// command sends the start bit, cmd and the data bits if any, with CS high after.
+// It reports whether the words changed
+func (pins *eepromPins) command(cmd uint16, data ...uint16) bool {
+	pins.mapper.WriteRAM(0xa080, 0x00)
+	pins.mapper.WriteRAM(0xa080, 0x80)
+
+	changed := pins.clock(1)
+	for i := 9; i >= 0; i-- {
+		changed = pins.clock(cmd>>uint(i)) || changed
+	}
+	for _, word := range data {
+		for i := 15; i >= 0; i-- {
+			changed = pins.clock(word>>uint(i)) || changed
+		}
+	}
+	return changed
+}
+
+// deselect pulls CS low
+func (pins *eepromPins) deselect() {
+	pins.mapper.WriteRAM(0xa080, 0x00)
+}
+
+func (pins *eepromPins) read(addr uint16) uint16 {
+	pins.t.Helper()
+
+	pins.command(eepromRead | addr)
+	if pins.do() != 0 {
+		pins.t.Error("READ didn't put the dummy bit on DO")
+	}
+
+	var word uint16
+	for i := 0; i < 16; i++ {
+		pins.clock(0)
+		word = word<<1 | uint16(pins.do())
+	}
+	pins.deselect()
+	return word
+}
+
+func TestEEPROMRead(t *testing.T) {
+	pins := newEEPROMPins(t, "KIRBY TNT")
+	if got := pins.read(0x12); got != 0xffff {
+		t.Errorf("blank word = %#04x, want 0xffff", got)
+	}
+
+	pins.command(eepromEWEN)
+	pins.command(eepromWrite|0x12, 0x5a3c)
+	pins.command(eepromWrite|0x13, 0x0ff0)
+	pins.deselect()
+	if got := pins.read(0x12); got != 0x5a3c {
+		t.Errorf("word = %#04x, want 0x5a3c", got)
+	}
+
+	// reading continues to the next word
+	pins.command(eepromRead | 0x12)
+	for i := 0; i < 16; i++ {
+		pins.clock(0)
+	}
+	var word uint16
+	for i := 0; i < 16; i++ {
+		pins.clock(0)
+		word = word<<1 | uint16(pins.do())
+	}
+	if word != 0x0ff0 {
+		t.Errorf("next word = %#04x, want 0x0ff0", word)
+	}
+}
+
+func TestEEPROMWriteEnable(t *testing.T) {
+	pins := newEEPROMPins(t, "KIRBY TNT")
+
+	// writes are disabled at power on
+	if pins.command(eepromWrite|0x05, 0x1234) {
+		t.Error("WRITE before EWEN reported a change")
+	}
+	pins.deselect()
+	if got := pins.read(0x05); got != 0xffff {
+		t.Errorf("word = %#04x after WRITE before EWEN, want 0xffff", got)
+	}
+
+	pins.command(eepromEWEN)
+	if !pins.command(eepromWrite|0x05, 0x1234) {
+		t.Error("WRITE after EWEN reported no change")
+	}
+	if pins.command(eepromWrite|0x05, 0x1234) {
+		t.Error("WRITE of the same word reported a change")
+	}
+
+	pins.command(eepromEWDS)
+	if pins.command(eepromWrite|0x05, 0x4321) || pins.command(eepromERAL) {
+		t.Error("WRITE or ERAL after EWDS reported a change")
+	}
+	pins.deselect()
+	if got := pins.read(0x05); got != 0x1234 {
+		t.Errorf("word = %#04x, want 0x1234", got)
+	}
+}
+
+func TestEEPROMEraseAll(t *testing.T) {
+	pins := newEEPROMPins(t, "KIRBY TNT")
+	pins.command(eepromEWEN)
+
+	if !pins.command(eepromWRAL, 0xa5a5) {
+		t.Error("WRAL reported no change")
+	}
+	pins.deselect()
+	for _, addr := range []uint16{0x00, 0x7f} {
+		if got := pins.read(addr); got != 0xa5a5 {
+			t.Errorf("word %#02x = %#04x after WRAL, want 0xa5a5", addr, got)
+		}
+	}
+
+	if !pins.command(eepromErase | 0x7f) {
+		t.Error("ERASE reported no change")
+	}
+	pins.deselect()
+	if got := pins.read(0x7f); got != 0xffff {
+		t.Errorf("word = %#04x after ERASE, want 0xffff", got)
+	}
+
+	if !pins.command(eepromERAL) {
+		t.Error("ERAL reported no change")
+	}
+	if pins.command(eepromERAL) {
+		t.Error("ERAL of a blank EEPROM reported a change")
+	}
+	pins.deselect()
+	if got := pins.read(0x00); got != 0xffff {
+		t.Errorf("word = %#04x after ERAL, want 0xffff", got)
+	}
+}
+
+func TestEEPROMBusy(t *testing.T) {
+	pins := newEEPROMPins(t, "KIRBY TNT")
+	pins.command(eepromEWEN)
+	if pins.do() != 1 {
+		t.Error("DO busy after EWEN")
+	}
+
+	pins.command(eepromWrite|0x01, 0x0001)
+	if pins.do() != 0 {
+		t.Error("DO ready right after WRITE, want busy until CS goes low")
+	}
+
+	pins.deselect()
+	pins.mapper.WriteRAM(0xa080, 0x80)
+	if pins.do() != 1 {
+		t.Error("DO busy after CS went low")
+	}
+}
+
+func TestEEPROMSize(t *testing.T) {
+	tests := []struct {
+		title string
+		words int
+	}{
+		{"KIRBY TNT", 128},
+		{"COMMAND MASTER", 256},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			pins := newEEPROMPins(t, tt.title)
+			pins.command(eepromEWEN)
+			pins.command(eepromWrite|0x00, 0x1111)
+			pins.command(eepromWrite|0x80, 0x2222)
+			pins.deselect()
+
+			// 93LC56 ignores address bit 7
+			want := uint16(0x1111)
+			if tt.words == 128 {
+				want = 0x2222
+			}
+			if got := pins.read(0x00); got != want {
+				t.Errorf("word 0 = %#04x, want %#04x", got, want)
+			}
+
+			if got := len(pins.mapper.BatteryData()); got != tt.words*2 {
+				t.Errorf("battery data is %d bytes, want %d", got, tt.words*2)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package mmu
+
+import (
+	"gbemu/cartridge"
+	"gbemu/utils"
+	"io"
+)
+
+// mmm01 is the controller of multi-game collections like Momotarou Collection 2.
+// It boots unmapped with the last 32KB of ROM, where the menu is, at 0x0000-0x7fff.
+// The menu sets the ROM/RAM offset of a game and maps it by setting bit 6 of 0x0000-0x1fff.
+// After that it works like MBC1 and the offset registers are locked.
+//
+// 0x0000-0x1fff: RAM enable. bit 6 maps the game
+// 0x2000-0x3fff: ROM bank bits 0-4. bits 5-6 are ROM bank bits 5-6 before mapped
+// 0x4000-0x5fff: RAM bank bits 0-1. before mapped, bits 2-3 are RAM bank bits 2-3,
+// bits 4-5 are ROM bank bits 7-8 and bit 6 locks the mode register
+// 0x6000-0x7fff: MBC1 mode. before mapped, bits 2-5 mask ROM bank bits 1-4 from the game
+// reference: https://gbdev.io/pandocs/MMM01.html
+type mmm01 struct {
+	rom cartROM
+	ram cartRAM
+
+	mapped     bool
+	ramEnabled bool
+	romBankLo  uint8 // 5 bits. 0 is mapped to 1
+	romBankMid uint8 // 2 bits
+	romBankHi  uint8 // 2 bits
+	ramBankLo  uint8 // 2 bits
+	ramBankHi  uint8 // 2 bits
+	mode       uint8
+	modeLocked bool
+	romMask    uint8 // ROM bank bits 1-4 fixed to the game's offset
+}
+
+func newMMM01(header *cartridge.Header, rom []byte) *mmm01 {
+	return &mmm01{
+		rom: newCartROM(header, rom),
+		ram: make(cartRAM, header.RAMSize()),
+	}
+}
+
+func (mbc *mmm01) romBankHigh() int {
+	return int(mbc.romBankHi)<<7 | int(mbc.romBankMid)<<5
+}
+
+func (mbc *mmm01) ReadROM(addr uint16) uint8 {
+	if !mbc.mapped {
+		// all the bank lines are high. the last 32KB
+		if addr <= 0x3fff {
+			return mbc.rom.read(0x1fe, addr)
+		}
+		return mbc.rom.read(0x1ff, addr)
+	}
+
+	if addr <= 0x3fff {
+		return mbc.rom.read(mbc.romBankHigh()|int(mbc.romBankLo&mbc.romMask), addr)
+	}
+	// the zero check is done on the bits the game can change
+	bank := mbc.romBankLo
+	if bank&^mbc.romMask == 0 {
+		bank |= 1
+	}
+	return mbc.rom.read(mbc.romBankHigh()|int(bank), addr)
+}
+
+func (mbc *mmm01) WriteROM(addr uint16, val uint8) {
+	switch {
+	case addr <= 0x1fff:
+		mbc.ramEnabled = ramEnableValue(val)
+		if !mbc.mapped && val&0x40 > 0 {
+			mbc.mapped = true
+		}
+
+	case addr <= 0x3fff:
+		if mbc.mapped {
+			mbc.romBankLo = mbc.romBankLo&mbc.romMask | val&0x1f&^mbc.romMask
+		} else {
+			mbc.romBankLo = val & 0x1f
+		}
+		if !mbc.mapped {
+			mbc.romBankMid = val >> 5 & 0x3
+		}
+
+	case addr <= 0x5fff:
+		mbc.ramBankLo = val & 0x3
+		if !mbc.mapped {
+			mbc.ramBankHi = val >> 2 & 0x3
+			mbc.romBankHi = val >> 4 & 0x3
+			mbc.modeLocked = val&0x40 > 0
+		}
+
+	default:
+		if !mbc.modeLocked {
+			mbc.mode = val & 1
+		}
+		if !mbc.mapped {
+			mbc.romMask = val >> 1 & 0x1e
+		}
+	}
+}
+
+func (mbc *mmm01) ramBank() int {
+	bank := int(mbc.ramBankHi) << 2
+	if mbc.mode == 1 {
+		bank |= int(mbc.ramBankLo)
+	}
+	return bank
+}
+
+func (mbc *mmm01) ReadRAM(addr uint16) uint8 {
+	if !mbc.ramEnabled {
+		return 0xff
+	}
+	return mbc.ram.read(mbc.ramBank(), addr)
+}
+
+func (mbc *mmm01) WriteRAM(addr uint16, val uint8) bool {
+	if !mbc.ramEnabled {
+		return false
+	}
+	return mbc.ram.write(mbc.ramBank(), addr, val)
+}
+
+func (mbc *mmm01) stateFields() []interface{} {
+	return []interface{}{
+		[]byte(mbc.ram), &mbc.mapped, &mbc.ramEnabled,
+		&mbc.romBankLo, &mbc.romBankMid, &mbc.romBankHi, &mbc.ramBankLo, &mbc.ramBankHi,
+		&mbc.mode, &mbc.modeLocked, &mbc.romMask,
+	}
+}
+
+func (mbc *mmm01) SaveState(w io.Writer) error {
+	return utils.WriteState(w, mbc.stateFields())
+}
+
+func (mbc *mmm01) LoadState(r io.Reader) error {
+	return utils.ReadState(r, mbc.stateFields())
+}
+
+func (mbc *mmm01) BatteryData() []byte {
+	return append([]byte{}, mbc.ram...)
+}
+
+func (mbc *mmm01) LoadBatteryData(data []byte) {
+	copy(mbc.ram, data)
+}
+
+// isMMM01 reports whether the header of the menu in the last 32KB says MMM01.
+// Dumps often start with the header of the first game instead.
+func isMMM01(rom []byte) bool {
+	if len(rom) < 0x8000 {
+		return false
+	}
+	cartType := rom[len(rom)-0x8000+0x147]
+	return 0x0b <= cartType && cartType <= 0x0d
+}
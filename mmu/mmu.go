@@ -2,7 +2,10 @@ package mmu
 
 import (
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"gbemu/apu"
+	"gbemu/cartridge"
 	"gbemu/gpu"
 	"gbemu/joypad"
 	"gbemu/timer"
@@ -11,35 +14,39 @@ import (
 type MMU struct {
 	bios      [0x100]uint8
 	cartridge []byte
+	header    *cartridge.Header
 
 	memory    [0x20000]uint8
-	ramBanks  [0x20000]uint8
 	wramBanks [0x8000]uint8
 	svbk      uint8
 
 	IsBooting bool
 
+	// KEY1 (0xff4d) and double speed mode are only on CGB
+	cgbMode bool
+
 	gpu    *gpu.GPU
 	timer  *timer.Timer
 	joypad *joypad.Joypad
+	apu    *apu.APU
 
-	cartridgeType    uint8
-	currentROMBank   uint8
-	hiCurrentROMBank uint8
-	currentRAMBank   uint8
-	bankMode         uint8
-	// TODO: RTC shoudl be an array of registers
-	rtc uint8
+	// memory bank controller in the cartridge
+	mapper     Mapper
+	mapperName string
 
-	ramEnabled bool
-	rtcEnabled bool
+	// battery-backed RAM
+	hasBattery    bool
+	savePath      string
+	ramDirty      bool
+	ramIdleFrames int
 }
 
-func New(gpu *gpu.GPU, timer *timer.Timer, joypad *joypad.Joypad) *MMU {
+func New(gpu *gpu.GPU, timer *timer.Timer, joypad *joypad.Joypad, apu *apu.APU) *MMU {
 	mmu := &MMU{
 		gpu:    gpu,
 		timer:  timer,
 		joypad: joypad,
+		apu:    apu,
 	}
 
 	mmu.IsBooting = true
@@ -101,65 +108,71 @@ func New(gpu *gpu.GPU, timer *timer.Timer, joypad *joypad.Joypad) *MMU {
 	return mmu
 }
 
-func (mmu *MMU) CheckRB() bool {
-	return mmu.currentROMBank >= 64
-}
+// Load sets up the cartridge. Battery-backed RAM is restored from savePath if it exists.
+// A bad checksum is only reported because real hardware doesn't check the global checksum
+// and many homebrew ROMs don't bother to fix them up.
+// mapperName overrides the mapper detected from the cartridge. Empty means auto.
+func (mmu *MMU) Load(buf []byte, savePath string, mapperName string) error {
+	header, err := cartridge.Parse(buf)
+	var truncatedErr *cartridge.TruncatedError
+	if header == nil || errors.As(err, &truncatedErr) {
+		return err
+	}
 
-func (mmu *MMU) PrintCurrentRomBank() {
-	fmt.Println("-------")
-	fmt.Println(mmu.currentROMBank)
-	fmt.Println(mmu.currentRAMBank)
-}
+	var checksumErr *cartridge.ChecksumError
+	if errors.As(err, &checksumErr) {
+		fmt.Println("warning:", checksumErr)
+	}
 
-func (mmu *MMU) Load(buf []byte) {
-	mmu.cartridge = buf
+	// unlicensed carts may still be detected
+	var unsupportedErr *cartridge.UnsupportedMapperError
+	errors.As(err, &unsupportedErr)
+
+	if mapperName == "" {
+		mapperName = detectMapper(header, buf, unsupportedErr == nil)
+		if mapperName == "" {
+			// types in the header like MBC6 and TAMA5 have no mapper here
+			return &cartridge.UnsupportedMapperError{Type: header.CartridgeType}
+		}
+	}
+
+	if mapperName == "mmm01" && header.Mapper() != cartridge.MMM01 && len(buf) >= 0x8000 {
+		// use the header of the menu in the last 32KB instead of the first game's
+		if menu, _ := cartridge.Parse(buf[len(buf)-0x8000:]); menu != nil {
+			header = menu
+		}
+	}
 
-	mmu.cartridgeType = mmu.getCartridgeType()
+	mapper, err := newMapper(mapperName, header, buf)
+	if err != nil {
+		return err
+	}
 
-	fmt.Println(mmu.cartridgeType)
+	mmu.cartridge = buf
+	mmu.header = header
+	mmu.mapper = mapper
+	mmu.mapperName = mapperName
+	mmu.hasBattery = header.HasBattery()
+	mmu.savePath = savePath
 
-	// set up registers related to cartridge
-	mmu.currentROMBank = 1
-	mmu.currentRAMBank = 0
-	mmu.ramEnabled = false
-	mmu.rtcEnabled = false
-	mmu.bankMode = romBankingMode
+	return mmu.loadRAM()
 }
 
-func (mmu *MMU) getCartridgeType() uint8 {
-	// TODO: support more cartridge type
-	switch mmu.cartridge[0x147] {
-
-	case 0:
-		return ROMONLY
-	case 0x01, 0x02, 0x03:
-		return MBC1
-	case 0x0f, 0x10, 0x11, 0x12, 0x13:
-		return MBC3
-	case 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e:
-		return MBC5
-	}
+// Header returns the header of the loaded cartridge
+func (mmu *MMU) Header() *cartridge.Header {
+	return mmu.header
+}
 
-	return 0
+// MapperName returns the name of the mapper in use
+func (mmu *MMU) MapperName() string {
+	return mmu.mapperName
 }
 
 func (mmu *MMU) Read(addr uint16) uint8 {
 	switch {
-	// Cartridge ROM, bank 0
-	case addr <= 0x3fff:
-		return mmu.cartridge[addr]
-
-	// Cartridge ROM, other banks
-	case 0x4000 <= addr && addr <= 0x7fff:
-		if mmu.cartridgeType == MBC5 {
-			// return mmu.cartridge[uint32(addr)+(uint32(mmu.hiCurrentROMBank)<<9|uint32(mmu.currentROMBank-1))<<14]
-			if mmu.currentROMBank == 0 {
-				return mmu.cartridge[addr-0x4000]
-			}
-			return mmu.cartridge[uint32(addr)+(uint32(mmu.hiCurrentROMBank)<<9|uint32(mmu.currentROMBank-1))<<14]
-		} else {
-			return mmu.cartridge[uint32(addr)+uint32(mmu.currentROMBank-1)<<14]
-		}
+	// Cartridge ROM
+	case addr <= 0x7fff:
+		return mmu.mapper.ReadROM(addr)
 
 	// VRAM
 	case 0x8000 <= addr && addr <= 0x9fff:
@@ -167,13 +180,7 @@ func (mmu *MMU) Read(addr uint16) uint8 {
 
 	// Cartridge RAM memory bank or RTC
 	case 0xa000 <= addr && addr <= 0xbfff:
-		if mmu.ramEnabled {
-			if mmu.rtcEnabled {
-				return 0x00
-			}
-			return mmu.ramBanks[(int(addr)-0xa000)+int(mmu.currentRAMBank)*0x2000]
-		}
-		return mmu.ramBanks[(int(addr)-0xa000)+int(mmu.currentRAMBank)*0x2000]
+		return mmu.mapper.ReadRAM(addr)
 
 	// CGB Mode only WRAM Bank
 	case 0xd000 <= addr && addr <= 0xdfff:
@@ -195,17 +202,22 @@ func (mmu *MMU) Read(addr uint16) uint8 {
 	case 0xff04 <= addr && addr <= 0xff07:
 		return mmu.timer.Read(addr)
 
+	// Sound and wave pattern RAM
+	case 0xff10 <= addr && addr <= 0xff3f:
+		return mmu.apu.Read(addr)
+
 	case addr == 0xff4c:
 		// fmt.Println
-		mmu.PrintCurrentRomBank()
 		hex.Dump(mmu.cartridge)
 		fmt.Println("trying access invalid ff4c")
 		return 0xff
 
-	// prepare speed switch
+	// prepare speed switch. bit 7: current speed, bit 0: switch armed
 	case addr == 0xff4d:
-		fmt.Println("Prepare Speed Switch")
-		return mmu.memory[0xff4d]
+		if !mmu.cgbMode {
+			return 0xff
+		}
+		return mmu.memory[0xff4d] | 0x7e
 
 	// LCD
 	case 0xff40 <= addr && addr <= 0xff4f:
@@ -238,7 +250,7 @@ func (mmu *MMU) Write(addr uint16, val uint8) {
 	switch {
 	// MBC
 	case addr < 0x8000:
-		mmu.handleMBC(addr, val)
+		mmu.mapper.WriteROM(addr, val)
 		return
 
 	// VRAM
@@ -248,14 +260,11 @@ func (mmu *MMU) Write(addr uint16, val uint8) {
 
 	// RAM Bank or RTC
 	case 0xa000 <= addr && addr <= 0xbfff:
-		if mmu.ramEnabled {
-			if mmu.rtcEnabled {
-				mmu.rtc = val
-				return
-			}
-			mmu.ramBanks[(int(addr)-0xa000)+int(mmu.currentRAMBank)*0x2000] = val
-			return
+		// disabled RAM and writes of the same value don't need a save
+		if mmu.mapper.WriteRAM(addr, val) {
+			mmu.markRAMDirty()
 		}
+		return
 
 	// CGB Mode only WRAM Bank
 	case 0xd000 <= addr && addr <= 0xdfff:
@@ -277,10 +286,17 @@ func (mmu *MMU) Write(addr uint16, val uint8) {
 		mmu.timer.Write(addr, val)
 		return
 
+	// Sound and wave pattern RAM
+	case 0xff10 <= addr && addr <= 0xff3f:
+		mmu.apu.Write(addr, val)
+		return
+
 	// CGB Mode prepare speed switch
 	case addr == 0xff4d:
-		mmu.memory[0xff4d] = val
-		// TODO: double speed mode
+		// only bit 0 is writable. STOP switches the speed
+		if mmu.cgbMode {
+			mmu.memory[0xff4d] = mmu.memory[0xff4d]&0x80 | val&1
+		}
 		return
 
 	// LCD
@@ -395,6 +411,58 @@ func (mmu *MMU) UpdateIntFlag() {
 	mmu.Write(0xff0f, intFlag)
 }
 
-func (mmu *MMU) CallTimer(ticks uint8) {
+// Tick runs the rest of the system for ticks of the CPU clock
+// and returns the ticks that passed at the normal speed.
+// The CPU calls it for every machine cycle before accessing memory.
+// In double speed mode the timer runs at the CPU clock
+// while the PPU, the APU and the cartridge stay at the normal speed.
+func (mmu *MMU) Tick(ticks uint8) uint8 {
 	mmu.timer.Update(ticks)
+
+	if mmu.DoubleSpeed() {
+		ticks /= 2
+	}
+
+	mmu.gpu.Update(ticks)
+	mmu.apu.Update(ticks)
+	if mapper, ok := mmu.mapper.(tickMapper); ok {
+		mapper.tick(ticks)
+	}
+
+	// requests are cleared by the next update, so collect them every cycle
+	mmu.UpdateIntFlag()
+
+	return ticks
+}
+
+// SetCGBMode enables the CGB speed switch
+func (mmu *MMU) SetCGBMode() {
+	mmu.cgbMode = true
+}
+
+// DoubleSpeed reports whether the CPU runs in CGB double speed mode
+func (mmu *MMU) DoubleSpeed() bool {
+	return mmu.memory[0xff4d]&0x80 > 0
+}
+
+// SpeedSwitchArmed reports whether KEY1 is prepared for the speed switch by STOP
+func (mmu *MMU) SpeedSwitchArmed() bool {
+	return mmu.cgbMode && mmu.memory[0xff4d]&1 > 0
+}
+
+// SwitchSpeed toggles double speed mode, disarms KEY1 and resets DIV
+func (mmu *MMU) SwitchSpeed() {
+	mmu.memory[0xff4d] = (mmu.memory[0xff4d] ^ 0x80) & 0x80
+	mmu.timer.Write(0xff04, 0)
+}
+
+// EnterStopMode turns the LCD white and resets DIV as the clock stops
+func (mmu *MMU) EnterStopMode() {
+	mmu.gpu.ResetFrame()
+	mmu.timer.Write(0xff04, 0)
+}
+
+// ButtonPressed reports whether any button is held, which wakes the CPU from STOP
+func (mmu *MMU) ButtonPressed() bool {
+	return mmu.joypad.Pressed()
 }
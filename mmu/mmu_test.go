@@ -0,0 +1,31 @@
+package mmu
+
+import (
+	"errors"
+	"gbemu/apu"
+	"gbemu/cartridge"
+	"gbemu/gpu"
+	"gbemu/joypad"
+	"gbemu/timer"
+	"testing"
+)
+
+func TestLoadUnsupportedMapper(t *testing.T) {
+	// MBC6 and TAMA5 are in the header table but have no mapper. 0x2a is unknown
+	for _, cartType := range []uint8{0x20, 0xfd, 0x2a} {
+		rom := testROM(2)
+		rom[0x147] = cartType
+
+		mmu := New(gpu.New(), timer.New(), joypad.New(), apu.New())
+		err := mmu.Load(rom, "", "")
+
+		var unsupportedErr *cartridge.UnsupportedMapperError
+		if !errors.As(err, &unsupportedErr) || unsupportedErr == nil {
+			t.Errorf("type %#02x: Load returned %v, want *cartridge.UnsupportedMapperError", cartType, err)
+			continue
+		}
+		if unsupportedErr.Type != cartType {
+			t.Errorf("type %#02x: error has type %#02x", cartType, unsupportedErr.Type)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package mmu
+
+import (
+	"gbemu/camera"
+	"gbemu/cartridge"
+	"gbemu/utils"
+	"io"
+)
+
+const (
+	cameraRegCount = 0x36
+	// the captured image is written to RAM bank 0 from 0xa100 as 16x14 tiles
+	cameraImageAddr = 0x100
+	cameraImageSize = camera.Width * camera.Height / 4
+)
+
+// pocketCamera is the MAC-GBD controller of the Game Boy Camera with a 128KB RAM.
+// 0x0000-0x1fff: RAM write enable, 0x0a
+// 0x2000-0x3fff: ROM bank, 6 bits
+// 0x4000-0x5fff: RAM bank, 4 bits. Setting bit 4 maps the camera registers instead
+//
+// Registers are mirrored in 0xa000-0xa07f
+// 0xa000: bit 0 starts capturing and is cleared when done. Only this one can be read
+// 0xa001: bit 7 N, bits 5-6 VH edge enhancement, bits 0-4 gain
+// 0xa002-0xa003: exposure time in 16 CPU cycles, big endian
+// 0xa004: bit 3 invert, bits 4-6 edge enhancement ratio
+// 0xa005: bits 0-5 output offset
+// 0xa006-0xa035: 4x4 dithering matrix. 3 thresholds for each pixel
+// reference: https://gbdev.io/pandocs/Gameboy_Camera.html
+type pocketCamera struct {
+	rom cartROM
+	ram cartRAM
+
+	ramEnabled bool
+	romBank    uint8
+	ramBank    uint8
+
+	regs [cameraRegCount]uint8
+	// CPU cycles until the capture is done. 0 when not capturing
+	captureCycles int32
+	captured      camera.Frame
+
+	source camera.Source
+}
+
+func newPocketCamera(header *cartridge.Header, rom []byte) *pocketCamera {
+	return &pocketCamera{
+		rom:    newCartROM(header, rom),
+		ram:    make(cartRAM, header.RAMSize()),
+		source: camera.NewTestPattern(),
+	}
+}
+
+// cameraMapper is a mapper with an image sensor
+type cameraMapper interface {
+	setCameraSource(src camera.Source)
+}
+
+func (mbc *pocketCamera) setCameraSource(src camera.Source) {
+	mbc.source = src
+}
+
+// SetCameraSource connects src to the sensor of the Game Boy Camera.
+// It does nothing for other cartridges.
+func (mmu *MMU) SetCameraSource(src camera.Source) {
+	if mapper, ok := mmu.mapper.(cameraMapper); ok {
+		mapper.setCameraSource(src)
+	}
+}
+
+func (mbc *pocketCamera) ReadROM(addr uint16) uint8 {
+	if addr <= 0x3fff {
+		return mbc.rom.read(0, addr)
+	}
+	// unlike MBC1, bank 0 can be mapped here
+	return mbc.rom.read(int(mbc.romBank), addr)
+}
+
+func (mbc *pocketCamera) WriteROM(addr uint16, val uint8) {
+	switch {
+	case addr <= 0x1fff:
+		mbc.ramEnabled = ramEnableValue(val)
+
+	case addr <= 0x3fff:
+		mbc.romBank = val & 0x3f
+
+	case addr <= 0x5fff:
+		mbc.ramBank = val & 0x1f
+	}
+}
+
+func (mbc *pocketCamera) registersMapped() bool {
+	return mbc.ramBank&0x10 > 0
+}
+
+func (mbc *pocketCamera) ReadRAM(addr uint16) uint8 {
+	if mbc.registersMapped() {
+		if addr&0x7f == 0 {
+			return mbc.regs[0]
+		}
+		return 0x00
+	}
+
+	// the sensor is using RAM
+	if mbc.captureCycles > 0 {
+		return 0x00
+	}
+	return mbc.ram.read(int(mbc.ramBank), addr)
+}
+
+func (mbc *pocketCamera) WriteRAM(addr uint16, val uint8) bool {
+	if mbc.registersMapped() {
+		mbc.writeRegister(uint8(addr&0x7f), val)
+		return false
+	}
+
+	if !mbc.ramEnabled || mbc.captureCycles > 0 {
+		return false
+	}
+	return mbc.ram.write(int(mbc.ramBank), addr, val)
+}
+
+func (mbc *pocketCamera) writeRegister(reg uint8, val uint8) {
+	if int(reg) >= cameraRegCount {
+		return
+	}
+
+	if reg != 0 {
+		mbc.regs[reg] = val
+		return
+	}
+
+	mbc.regs[0] = val & 0x7
+	if val&1 > 0 && mbc.captureCycles == 0 {
+		mbc.startCapture()
+	} else if val&1 == 0 {
+		// stop capturing
+		mbc.captureCycles = 0
+	}
+}
+
+func (mbc *pocketCamera) exposure() int {
+	return int(mbc.regs[2])<<8 | int(mbc.regs[3])
+}
+
+// startCapture exposes the sensor. The image is written to RAM when the time passes
+func (mbc *pocketCamera) startCapture() {
+	mbc.captured = *mbc.source.Frame()
+
+	mbc.captureCycles = 32446 + 16*int32(mbc.exposure())
+	if mbc.regs[1]&0x80 == 0 {
+		mbc.captureCycles += 512
+	}
+}
+
+// tick advances the capture by CPU ticks
+func (mbc *pocketCamera) tick(ticks uint8) {
+	if mbc.captureCycles == 0 {
+		return
+	}
+
+	mbc.captureCycles -= int32(ticks)
+	if mbc.captureCycles <= 0 {
+		mbc.captureCycles = 0
+		mbc.processImage()
+		mbc.regs[0] &^= 1
+	}
+}
+
+// exposure at which the image comes out as the source gives it with the lowest gain.
+// The response of the sensor isn't documented, so this is a picked calibration point
+const cameraExposureScale = 0x300
+
+// edge enhancement ratios selected by 0xa004 bits 4-6, in quarters
+var cameraEdgeRatios = [8]int{2, 3, 4, 5, 8, 12, 16, 20}
+
+// sensorValue returns the brightness of the pixel after exposure and gain.
+// Pixels outside the image repeat the edge
+func (mbc *pocketCamera) sensorValue(x, y int) int {
+	x = clamp(x, 0, camera.Width-1)
+	y = clamp(y, 0, camera.Height-1)
+
+	// the analog gain curve isn't documented either, so it's linear from 1x to almost 3x
+	gain := 16 + int(mbc.regs[1]&0x1f)
+	return int(mbc.captured[y*camera.Width+x]) * mbc.exposure() * gain / (cameraExposureScale * 16)
+}
+
+// edgeEnhance sharpens val by the neighbors selected by 0xa001 bits 5-6 VH.
+// 1 uses the pixels on the left and right, 2 above and below, and 3 all of them
+func (mbc *pocketCamera) edgeEnhance(x, y, val int) int {
+	vh := mbc.regs[1] >> 5 & 3
+	ratio := cameraEdgeRatios[mbc.regs[4]>>4&7]
+
+	edge := 0
+	if vh&1 > 0 {
+		edge += 2*val - mbc.sensorValue(x-1, y) - mbc.sensorValue(x+1, y)
+	}
+	if vh&2 > 0 {
+		edge += 2*val - mbc.sensorValue(x, y-1) - mbc.sensorValue(x, y+1)
+	}
+	return val + edge*ratio/4
+}
+
+// processImage converts the captured image to 2bpp tiles with the dithering matrix.
+// 0xa005 bits 0-4 offset the output, up when bit 5 is set and down when not
+func (mbc *pocketCamera) processImage() {
+	if len(mbc.ram) < cameraImageAddr+cameraImageSize {
+		return
+	}
+
+	invert := mbc.regs[4]&0x08 > 0
+	// approximated as 4 levels per step
+	bias := int(mbc.regs[5]&0x1f) * 4
+	if mbc.regs[5]&0x20 == 0 {
+		bias = -bias
+	}
+
+	for y := 0; y < camera.Height; y++ {
+		for x := 0; x < camera.Width; x++ {
+			val := mbc.edgeEnhance(x, y, mbc.sensorValue(x, y))
+			val = clamp(val+bias, 0, 0xff)
+			if invert {
+				val = 0xff - val
+			}
+
+			// the darker, the more thresholds it's below
+			thresholds := mbc.regs[6+((y&3)*4+(x&3))*3:]
+			var color uint8
+			switch {
+			case val < int(thresholds[0]):
+				color = 3
+			case val < int(thresholds[1]):
+				color = 2
+			case val < int(thresholds[2]):
+				color = 1
+			}
+
+			tile := (y/8)*(camera.Width/8) + x/8
+			offset := cameraImageAddr + tile*16 + (y&7)*2
+			bit := uint8(0x80) >> uint(x&7)
+
+			mbc.ram[offset] &^= bit
+			mbc.ram[offset+1] &^= bit
+			if color&1 > 0 {
+				mbc.ram[offset] |= bit
+			}
+			if color&2 > 0 {
+				mbc.ram[offset+1] |= bit
+			}
+		}
+	}
+}
+
+func clamp(val, min, max int) int {
+	if val < min {
+		return min
+	}
+	if val > max {
+		return max
+	}
+	return val
+}
+
+func (mbc *pocketCamera) stateFields() []interface{} {
+	return []interface{}{
+		[]byte(mbc.ram), &mbc.ramEnabled, &mbc.romBank, &mbc.ramBank,
+		mbc.regs[:], &mbc.captureCycles, mbc.captured[:],
+	}
+}
+
+func (mbc *pocketCamera) SaveState(w io.Writer) error {
+	return utils.WriteState(w, mbc.stateFields())
+}
+
+func (mbc *pocketCamera) LoadState(r io.Reader) error {
+	return utils.ReadState(r, mbc.stateFields())
+}
+
+func (mbc *pocketCamera) BatteryData() []byte {
+	return append([]byte{}, mbc.ram...)
+}
+
+func (mbc *pocketCamera) LoadBatteryData(data []byte) {
+	copy(mbc.ram, data)
+}
@@ -0,0 +1,144 @@
+package mmu
+
+import (
+	"gbemu/camera"
+	"gbemu/cartridge"
+	"testing"
+)
+
+// frameSource always returns the same frame
+type frameSource struct {
+	frame camera.Frame
+}
+
+func (src *frameSource) Frame() *camera.Frame {
+	return &src.frame
+}
+
+// newTestCamera returns a Game Boy Camera with the registers mapped, the exposure
+// at cameraExposureScale and the thresholds at 0x40, 0x80 and 0xc0 for every pixel
+func newTestCamera(src camera.Source) *pocketCamera {
+	mbc := newPocketCamera(&cartridge.Header{CartridgeType: 0xfc, RAMSizeCode: 0x04}, testROM(8))
+	mbc.setCameraSource(src)
+
+	mbc.WriteROM(0x4000, 0x10)
+	mbc.WriteRAM(0xa001, 0x80)
+	mbc.WriteRAM(0xa002, cameraExposureScale>>8)
+	mbc.WriteRAM(0xa003, cameraExposureScale&0xff)
+	for i := uint16(0); i < 16; i++ {
+		mbc.WriteRAM(0xa006+i*3, 0x40)
+		mbc.WriteRAM(0xa007+i*3, 0x80)
+		mbc.WriteRAM(0xa008+i*3, 0xc0)
+	}
+	return mbc
+}
+
+// capture takes a picture and returns the ticks it took
+func (mbc *pocketCamera) capture() int {
+	mbc.WriteROM(0x4000, 0x10)
+	mbc.WriteRAM(0xa000, 0x01)
+
+	ticks := 0
+	for mbc.ReadRAM(0xa000)&1 > 0 {
+		mbc.tick(1)
+		ticks++
+	}
+	return ticks
+}
+
+// tileRow returns the 2 bytes of row y of tile in the captured image
+func (mbc *pocketCamera) tileRow(tile, y int) (uint8, uint8) {
+	mbc.WriteROM(0x4000, 0x00)
+	addr := uint16(0xa000 + cameraImageAddr + tile*16 + y*2)
+	return mbc.ReadRAM(addr), mbc.ReadRAM(addr + 1)
+}
+
+func TestCameraCaptureTestPattern(t *testing.T) {
+	mbc := newTestCamera(camera.NewTestPattern())
+	mbc.capture()
+
+	// the 4 bars of the top half from white to black
+	tests := []struct {
+		tile      int
+		low, high uint8
+	}{
+		{0, 0x00, 0x00},
+		{4, 0xff, 0x00},
+		{8, 0x00, 0xff},
+		{12, 0xff, 0xff},
+		{3*16 + 15, 0xff, 0xff},
+	}
+
+	for _, tt := range tests {
+		if low, high := mbc.tileRow(tt.tile, 0); low != tt.low || high != tt.high {
+			t.Errorf("tile %d: %#02x %#02x, want %#02x %#02x", tt.tile, low, high, tt.low, tt.high)
+		}
+	}
+}
+
+func TestCameraProcessing(t *testing.T) {
+	tests := []struct {
+		name      string
+		scene     uint8
+		regs      []mapperWrite
+		low, high uint8 // row 0 of tile 1. the column at x=10 is white
+	}{
+		{"plain", 0x90, nil, 0xdf, 0x00},
+		{"invert", 0x90, []mapperWrite{{0xa004, 0x08}}, 0x20, 0xff},
+		{"gain", 0x50, []mapperWrite{{0xa001, 0x80 | 0x10}}, 0xdf, 0x00},
+		{"no gain", 0x50, nil, 0x00, 0xdf},
+		{"offset up", 0x78, []mapperWrite{{0xa005, 0x20 | 0x04}}, 0xdf, 0x00},
+		{"offset down", 0x88, []mapperWrite{{0xa005, 0x04}}, 0x00, 0xdf},
+		// the white column darkens the pixels next to it by 0.5 * (144-255)
+		{"2D edge", 0x90, []mapperWrite{{0xa001, 0xe0}}, 0x8f, 0x50},
+		{"vertical edge", 0x90, []mapperWrite{{0xa001, 0xc0}}, 0xdf, 0x00},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := &frameSource{}
+			for i := range src.frame {
+				src.frame[i] = tt.scene
+			}
+			for y := 0; y < camera.Height; y++ {
+				src.frame[y*camera.Width+10] = 0xff
+			}
+
+			mbc := newTestCamera(src)
+			for _, w := range tt.regs {
+				mbc.WriteRAM(w.addr, w.val)
+			}
+			mbc.capture()
+
+			if low, high := mbc.tileRow(1, 0); low != tt.low || high != tt.high {
+				t.Errorf("tile row %#02x %#02x, want %#02x %#02x", low, high, tt.low, tt.high)
+			}
+		})
+	}
+}
+
+func TestCameraCaptureTime(t *testing.T) {
+	tests := []struct {
+		name     string
+		a001     uint8
+		exposure uint16
+		want     int
+	}{
+		{"N set", 0x80, 0x0300, 32446 + 16*0x0300},
+		{"N set, no exposure", 0x80, 0, 32446},
+		{"N clear", 0x00, 0x1234, 32446 + 512 + 16*0x1234},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mbc := newTestCamera(camera.NewTestPattern())
+			mbc.WriteRAM(0xa001, tt.a001)
+			mbc.WriteRAM(0xa002, uint8(tt.exposure>>8))
+			mbc.WriteRAM(0xa003, uint8(tt.exposure))
+
+			if got := mbc.capture(); got != tt.want {
+				t.Errorf("capture took %d ticks, want %d", got, tt.want)
+			}
+		})
+	}
+}
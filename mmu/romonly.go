@@ -0,0 +1,52 @@
+package mmu
+
+import (
+	"gbemu/cartridge"
+	"gbemu/utils"
+	"io"
+)
+
+// romOnly is a 32KB cartridge without a controller.
+// A few of them have 8KB RAM directly connected.
+type romOnly struct {
+	rom cartROM
+	ram cartRAM
+}
+
+func newROMOnly(header *cartridge.Header, rom []byte) *romOnly {
+	return &romOnly{
+		rom: newCartROM(header, rom),
+		ram: make(cartRAM, header.RAMSize()),
+	}
+}
+
+func (mbc *romOnly) ReadROM(addr uint16) uint8 {
+	return mbc.rom.read(int(addr>>14), addr)
+}
+
+// WriteROM does nothing. There are no registers
+func (mbc *romOnly) WriteROM(addr uint16, val uint8) {}
+
+func (mbc *romOnly) ReadRAM(addr uint16) uint8 {
+	return mbc.ram.read(0, addr)
+}
+
+func (mbc *romOnly) WriteRAM(addr uint16, val uint8) bool {
+	return mbc.ram.write(0, addr, val)
+}
+
+func (mbc *romOnly) SaveState(w io.Writer) error {
+	return utils.WriteState(w, []interface{}{[]byte(mbc.ram)})
+}
+
+func (mbc *romOnly) LoadState(r io.Reader) error {
+	return utils.ReadState(r, []interface{}{[]byte(mbc.ram)})
+}
+
+func (mbc *romOnly) BatteryData() []byte {
+	return append([]byte{}, mbc.ram...)
+}
+
+func (mbc *romOnly) LoadBatteryData(data []byte) {
+	copy(mbc.ram, data)
+}
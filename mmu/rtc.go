@@ -0,0 +1,180 @@
+package mmu
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// RTC registers selected by writing 0x08-0x0c to 0x4000-0x5fff
+const (
+	rtcSeconds  = 0x08
+	rtcMinutes  = 0x09
+	rtcHours    = 0x0a
+	rtcDayLow   = 0x0b
+	rtcDayHigh  = 0x0c
+	rtcRegCount = 5
+)
+
+// size of the clock data appended to the save file.
+// 5 registers and 5 latched registers as 32-bit values, then 64-bit UNIX time.
+// Some emulators write the UNIX time as 32-bit, which makes it 44 bytes.
+const (
+	rtcTrailerSize      = 48
+	rtcShortTrailerSize = 44
+)
+
+// for debugging the clock without waiting
+var timeNow = time.Now
+
+// rtc is the real time clock of MBC3.
+// Instead of ticking with the CPU, it catches up with the wall clock
+// whenever it's accessed so that it keeps running while the emulator is closed.
+type rtc struct {
+	seconds uint8
+	minutes uint8
+	hours   uint8
+	days    uint16 // 9 bit day counter
+	halt    bool   // DH bit 6
+	carry   bool   // DH bit 7. day counter overflow
+
+	latched  [rtcRegCount]uint8
+	latchReg uint8 // last value written to 0x6000-0x7fff
+
+	// UNIX time when the counters were last brought up to date
+	lastUpdate int64
+}
+
+func newRTC() rtc {
+	return rtc{lastUpdate: timeNow().Unix()}
+}
+
+// update advances the counters by the wall time passed since the last update
+func (rtc *rtc) update() {
+	now := timeNow().Unix()
+	elapsed := now - rtc.lastUpdate
+	rtc.lastUpdate = now
+
+	if rtc.halt || elapsed <= 0 {
+		return
+	}
+
+	seconds := int64(rtc.seconds) + elapsed
+	minutes := int64(rtc.minutes) + seconds/60
+	hours := int64(rtc.hours) + minutes/60
+	days := int64(rtc.days) + hours/24
+
+	rtc.seconds = uint8(seconds % 60)
+	rtc.minutes = uint8(minutes % 60)
+	rtc.hours = uint8(hours % 24)
+
+	if days > 0x1ff {
+		rtc.carry = true
+		days %= 0x200
+	}
+	rtc.days = uint16(days)
+}
+
+// register returns the live value of an RTC register
+func (rtc *rtc) register(reg uint8) uint8 {
+	switch reg {
+	case rtcSeconds:
+		return rtc.seconds
+	case rtcMinutes:
+		return rtc.minutes
+	case rtcHours:
+		return rtc.hours
+	case rtcDayLow:
+		return uint8(rtc.days)
+	case rtcDayHigh:
+		val := uint8(rtc.days>>8) & 1
+		if rtc.halt {
+			val |= 1 << 6
+		}
+		if rtc.carry {
+			val |= 1 << 7
+		}
+		return val
+	}
+	return 0xff
+}
+
+// read returns the latched value. Unused bits are read as 0
+func (rtc *rtc) read(reg uint8) uint8 {
+	if reg < rtcSeconds || reg > rtcDayHigh {
+		return 0xff
+	}
+	return rtc.latched[reg-rtcSeconds]
+}
+
+func (rtc *rtc) write(reg uint8, val uint8) {
+	rtc.update()
+
+	switch reg {
+	case rtcSeconds:
+		rtc.seconds = val & 0x3f
+	case rtcMinutes:
+		rtc.minutes = val & 0x3f
+	case rtcHours:
+		rtc.hours = val & 0x1f
+	case rtcDayLow:
+		rtc.days = rtc.days&0x100 | uint16(val)
+	case rtcDayHigh:
+		rtc.days = rtc.days&0xff | uint16(val&1)<<8
+		rtc.halt = val&0x40 > 0
+		rtc.carry = val&0x80 > 0
+	}
+}
+
+// latch copies the clock into the latched registers when 0 and then 1 are written
+func (rtc *rtc) latch(val uint8) {
+	if rtc.latchReg == 0 && val == 1 {
+		rtc.update()
+		for i := uint8(0); i < rtcRegCount; i++ {
+			rtc.latched[i] = rtc.register(rtcSeconds + i)
+		}
+	}
+	rtc.latchReg = val
+}
+
+// marshal returns the 48 bytes trailer of the save file
+func (rtc *rtc) marshal() []byte {
+	rtc.update()
+
+	data := make([]byte, rtcTrailerSize)
+	for i := uint8(0); i < rtcRegCount; i++ {
+		binary.LittleEndian.PutUint32(data[i*4:], uint32(rtc.register(rtcSeconds+i)))
+		binary.LittleEndian.PutUint32(data[20+i*4:], uint32(rtc.latched[i]))
+	}
+	binary.LittleEndian.PutUint64(data[40:], uint64(rtc.lastUpdate))
+
+	return data
+}
+
+// unmarshal restores the clock from the trailer of the save file
+func (rtc *rtc) unmarshal(data []byte) {
+	if len(data) != rtcTrailerSize && len(data) != rtcShortTrailerSize {
+		return
+	}
+
+	regs := [rtcRegCount]uint8{}
+	for i := 0; i < rtcRegCount; i++ {
+		regs[i] = uint8(binary.LittleEndian.Uint32(data[i*4:]))
+		rtc.latched[i] = uint8(binary.LittleEndian.Uint32(data[20+i*4:]))
+	}
+
+	rtc.seconds = regs[0]
+	rtc.minutes = regs[1]
+	rtc.hours = regs[2]
+	rtc.days = uint16(regs[3]) | uint16(regs[4]&1)<<8
+	rtc.halt = regs[4]&0x40 > 0
+	rtc.carry = regs[4]&0x80 > 0
+
+	if len(data) == rtcTrailerSize {
+		rtc.lastUpdate = int64(binary.LittleEndian.Uint64(data[40:]))
+	} else {
+		rtc.lastUpdate = int64(binary.LittleEndian.Uint32(data[40:]))
+	}
+
+	// catch up with the time the emulator was closed
+	rtc.update()
+}
@@ -0,0 +1,36 @@
+package mmu
+
+import (
+	"gbemu/utils"
+	"io"
+)
+
+func (mmu *MMU) stateFields() []interface{} {
+	return []interface{}{
+		mmu.memory[:], mmu.wramBanks[:], &mmu.svbk,
+		&mmu.IsBooting,
+	}
+}
+
+// SaveState writes memory, RAM banks and MBC registers.
+// The cartridge ROM itself is not included.
+func (mmu *MMU) SaveState(w io.Writer) error {
+	if err := utils.WriteState(w, mmu.stateFields()); err != nil {
+		return err
+	}
+	return mmu.mapper.SaveState(w)
+}
+
+// LoadState restores the state written by SaveState
+func (mmu *MMU) LoadState(r io.Reader) error {
+	if err := utils.ReadState(r, mmu.stateFields()); err != nil {
+		return err
+	}
+	if err := mmu.mapper.LoadState(r); err != nil {
+		return err
+	}
+
+	// cartridge RAM may differ from the save file now
+	mmu.markRAMDirty()
+	return nil
+}
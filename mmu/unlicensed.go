@@ -0,0 +1,170 @@
+package mmu
+
+import (
+	"bytes"
+	"gbemu/cartridge"
+	"gbemu/utils"
+	"io"
+)
+
+// Unlicensed carts don't have a proper header, so they are found by heuristics.
+//
+// BHGOS multicarts are not supported. Their registers aren't documented well enough
+// to write a mapper, so they are not detected and load with the mapper in the header.
+
+// wisdomTree is the mapper of Wisdom Tree games.
+// Writing to 0x0000-0x3fff maps the 32KB bank by the low byte of the address to 0x0000-0x7fff.
+// There is no RAM.
+type wisdomTree struct {
+	rom  cartROM
+	bank uint8
+}
+
+func newWisdomTree(header *cartridge.Header, rom []byte) *wisdomTree {
+	return &wisdomTree{rom: newCartROM(header, rom)}
+}
+
+// isWisdomTree detects Wisdom Tree games. The header says ROM only (or 0xc0)
+// but the ROM is larger than 32KB and has the name of the company in it
+func isWisdomTree(rom []byte) bool {
+	if len(rom) <= 0x8000 || (rom[0x147] != 0x00 && rom[0x147] != 0xc0) {
+		return false
+	}
+	return bytes.Contains(rom, []byte("WISDOM TREE")) || bytes.Contains(rom, []byte("WISDOM\x00TREE"))
+}
+
+func (mbc *wisdomTree) ReadROM(addr uint16) uint8 {
+	return mbc.rom.read(int(mbc.bank)*2+int(addr>>14), addr)
+}
+
+func (mbc *wisdomTree) WriteROM(addr uint16, val uint8) {
+	if addr <= 0x3fff {
+		mbc.bank = uint8(addr)
+	}
+}
+
+func (mbc *wisdomTree) ReadRAM(addr uint16) uint8 {
+	return 0xff
+}
+
+func (mbc *wisdomTree) WriteRAM(addr uint16, val uint8) bool { return false }
+
+func (mbc *wisdomTree) SaveState(w io.Writer) error {
+	return utils.WriteState(w, []interface{}{&mbc.bank})
+}
+
+func (mbc *wisdomTree) LoadState(r io.Reader) error {
+	return utils.ReadState(r, []interface{}{&mbc.bank})
+}
+
+func (mbc *wisdomTree) BatteryData() []byte {
+	return nil
+}
+
+func (mbc *wisdomTree) LoadBatteryData(data []byte) {}
+
+// sachen is the Sachen MMC1 mapper used by their single games and multicarts.
+// 0x0000-0x1fff: base ROM bank
+// 0x2000-0x3fff: ROM bank. 0 is mapped to 1
+// 0x4000-0x5fff: ROM bank mask. bits set are taken from the base bank
+// The base and the mask can be written only while ROM bank bits 4-5 are set,
+// so the menu of a multicart can lock a game in.
+// There is no RAM.
+//
+// In locked mode the cart scrambles the address lines while the boot ROM reads the logo.
+// The boot ROM is skipped here, so only the mapper is emulated.
+type sachen struct {
+	rom cartROM
+
+	baseBank uint8
+	romBank  uint8
+	mask     uint8
+}
+
+func newSachen(header *cartridge.Header, rom []byte) *sachen {
+	return &sachen{rom: newCartROM(header, rom), romBank: 1}
+}
+
+// sachenLogoAddr returns where the Nintendo logo is read from in locked mode.
+// A0 and A6, and A1 and A4 are swapped
+func sachenLogoAddr(addr int) int {
+	swap := func(addr int, a, b uint) int {
+		bitA, bitB := addr>>a&1, addr>>b&1
+		addr &^= 1<<a | 1<<b
+		return addr | bitA<<b | bitB<<a
+	}
+	return swap(swap(addr, 0, 6), 1, 4)
+}
+
+// isSachen detects Sachen carts by the scrambled Nintendo logo
+func isSachen(rom []byte) bool {
+	if len(rom) < 0x8000 {
+		return false
+	}
+	if bytes.Equal(rom[0x104:0x134], nintendoLogo) {
+		return false
+	}
+
+	for i, val := range nintendoLogo {
+		if rom[sachenLogoAddr(0x104+i)] != val {
+			return false
+		}
+	}
+	return true
+}
+
+func (mbc *sachen) unlocked() bool {
+	return mbc.romBank&0x30 == 0x30
+}
+
+func (mbc *sachen) ReadROM(addr uint16) uint8 {
+	base := mbc.baseBank & mbc.mask
+	if addr <= 0x3fff {
+		return mbc.rom.read(int(base), addr)
+	}
+	return mbc.rom.read(int(base|mbc.romBank&^mbc.mask), addr)
+}
+
+func (mbc *sachen) WriteROM(addr uint16, val uint8) {
+	switch {
+	case addr <= 0x1fff:
+		if mbc.unlocked() {
+			mbc.baseBank = val
+		}
+
+	case addr <= 0x3fff:
+		mbc.romBank = val
+		if mbc.romBank == 0 {
+			mbc.romBank = 1
+		}
+
+	case addr <= 0x5fff:
+		if mbc.unlocked() {
+			mbc.mask = val
+		}
+	}
+}
+
+func (mbc *sachen) ReadRAM(addr uint16) uint8 {
+	return 0xff
+}
+
+func (mbc *sachen) WriteRAM(addr uint16, val uint8) bool { return false }
+
+func (mbc *sachen) stateFields() []interface{} {
+	return []interface{}{&mbc.baseBank, &mbc.romBank, &mbc.mask}
+}
+
+func (mbc *sachen) SaveState(w io.Writer) error {
+	return utils.WriteState(w, mbc.stateFields())
+}
+
+func (mbc *sachen) LoadState(r io.Reader) error {
+	return utils.ReadState(r, mbc.stateFields())
+}
+
+func (mbc *sachen) BatteryData() []byte {
+	return nil
+}
+
+func (mbc *sachen) LoadBatteryData(data []byte) {}
@@ -0,0 +1,24 @@
+package timer
+
+import (
+	"gbemu/utils"
+	"io"
+)
+
+func (timer *Timer) stateFields() []interface{} {
+	return []interface{}{
+		&timer.div, &timer.tima, &timer.tma, &timer.tac,
+		&timer.dividerCounter, &timer.timerCounter,
+		&timer.ReqTimerInt,
+	}
+}
+
+// SaveState writes the timer registers and internal counters
+func (timer *Timer) SaveState(w io.Writer) error {
+	return utils.WriteState(w, timer.stateFields())
+}
+
+// LoadState restores the state written by SaveState
+func (timer *Timer) LoadState(r io.Reader) error {
+	return utils.ReadState(r, timer.stateFields())
+}
@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// WriteState writes fields in order in little endian.
+// Each field must be a pointer to a fixed-size value (or an array of them) or a byte slice.
+func WriteState(w io.Writer, fields []interface{}) error {
+	for _, field := range fields {
+		if err := binary.Write(w, binary.LittleEndian, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadState reads fields in the same order as WriteState wrote them
+func ReadState(r io.Reader, fields []interface{}) error {
+	for _, field := range fields {
+		if err := binary.Read(r, binary.LittleEndian, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}